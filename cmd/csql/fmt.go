@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kevin-cantwell/csql/internal/ast"
+)
+
+// runFmt implements "csql fmt [file]": it reads SQL from the file, or from stdin
+// when no file or "-" is given, and writes it back in canonical form.
+func runFmt(args []string) {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "usage: csql fmt [file.sql]")
+		os.Exit(1)
+	}
+
+	var (
+		text []byte
+		err  error
+	)
+	if len(args) == 0 || args[0] == "-" {
+		text, err = io.ReadAll(os.Stdin)
+	} else {
+		text, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	query := string(text)
+	stmts, err := ast.NewParser(strings.NewReader(query)).Parse()
+	if err != nil {
+		printQueryError("parse error", query, err)
+		os.Exit(1)
+	}
+	fmt.Print(ast.Format(stmts))
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/kevin-cantwell/csql/internal/ast"
@@ -11,43 +15,66 @@ import (
 	"github.com/kevin-cantwell/csql/internal/source"
 )
 
-type sourceFlag []string
+// listFlag collects the values of a flag that may be repeated.
+type listFlag []string
 
-func (s *sourceFlag) String() string { return strings.Join(*s, ", ") }
-func (s *sourceFlag) Set(v string) error {
+func (s *listFlag) String() string { return strings.Join(*s, ", ") }
+func (s *listFlag) Set(v string) error {
 	*s = append(*s, v)
 	return nil
 }
 
 func main() {
-	var sources sourceFlag
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		runFmt(os.Args[2:])
+		return
+	}
+
+	var sources, params, jsonParams listFlag
 	flag.Var(&sources, "source", "Data source in name=uri format (e.g., users=file://users.csv)")
+	flag.Var(&params, "param", "Query parameter in name=value format, typed like a CSV value (e.g., user=alice or 1=42)")
+	flag.Var(&jsonParams, "param-json", "Query parameter in name=json format (e.g., ids='[1,2]')")
+	script := flag.String("f", "", "Run the statements in a SQL script file")
+	explain := flag.Bool("explain", false, "Print how each statement would run, as with EXPLAIN, instead of running it")
+	statementKey := flag.String("statement-key", "", "Add a field with this name to each row, holding the number of the statement it came from (default: a blank line between the output of statements)")
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) == 0 {
-		fmt.Fprintln(os.Stderr, "usage: csql [--source name=uri ...] 'SQL query'")
+	var query string
+	switch {
+	case *script == "" && len(args) > 0:
+		query = args[0]
+	case *script != "" && len(args) == 0:
+		text, err := os.ReadFile(*script)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		query = string(text)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: csql [--source name=uri ...] [--param name=value ...] 'SQL query'")
+		fmt.Fprintln(os.Stderr, "       csql [--source name=uri ...] [--param name=value ...] -f script.sql")
+		fmt.Fprintln(os.Stderr, "       csql fmt [file.sql]")
 		os.Exit(1)
 	}
-	query := args[0]
 
-	// Parse the query
+	// Parse the statements
 	parser := ast.NewParser(strings.NewReader(query))
 	stmts, err := parser.Parse()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "parse error: %v\n", err)
+		printQueryError("parse error", query, err)
 		os.Exit(1)
 	}
-	if len(stmts) == 0 || stmts[0].Select == nil {
+	if len(stmts) == 0 {
 		fmt.Fprintln(os.Stderr, "no SELECT statement found")
 		os.Exit(1)
 	}
-	sel := stmts[0].Select
 
 	// Build engine
 	eng := engine.New(os.Stdout)
 
-	// Parse and add explicit sources
+	// Parse and add explicit sources. Their names are kept in lower case, since
+	// SQLite matches table names without regard to case.
 	explicitSources := map[string]bool{}
 	for _, s := range sources {
 		parts := strings.SplitN(s, "=", 2)
@@ -67,16 +94,39 @@ func main() {
 			os.Exit(1)
 		}
 		eng.AddSource(src)
-		explicitSources[name] = true
+		explicitSources[strings.ToLower(name)] = true
+	}
+
+	// Bind query parameters
+	for _, p := range params {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			fmt.Fprintf(os.Stderr, "invalid param: %q (expected name=value)\n", p)
+			os.Exit(1)
+		}
+		eng.SetParam(parts[0], source.InferType(parts[1]))
+	}
+	for _, p := range jsonParams {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			fmt.Fprintf(os.Stderr, "invalid param-json: %q (expected name=json)\n", p)
+			os.Exit(1)
+		}
+		v, err := parseJSONParam(parts[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid param-json %s: %v\n", parts[0], err)
+			os.Exit(1)
+		}
+		eng.SetParam(parts[0], v)
 	}
 
-	// Determine which tables the query references
-	tables := collectTableNames(sel)
+	// Determine which tables the statements reference
+	tables := collectTableNames(stmts)
 
 	// Any table not in explicit sources defaults to stdin
 	hasStdin := false
 	for _, t := range tables {
-		if !explicitSources[t] {
+		if !explicitSources[strings.ToLower(t)] {
 			if hasStdin {
 				fmt.Fprintf(os.Stderr, "multiple tables reference stdin; use --source to specify\n")
 				os.Exit(1)
@@ -86,31 +136,149 @@ func main() {
 		}
 	}
 
-	// Execute
-	if err := eng.Execute(sel); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+	// Execute each statement in turn. Sources are read once and shared.
+	eng.SetReplay(len(stmts) > 1)
+	for i, stmt := range stmts {
+		if *statementKey != "" {
+			eng.SetTag(*statementKey, i+1)
+		} else if i > 0 {
+			fmt.Println()
+		}
+		run := eng.Execute
+		if *explain || stmt.Explain {
+			run = eng.Explain
+		}
+		if err := run(stmt.Select); err != nil {
+			printQueryError("error", query, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// printQueryError writes err to stderr after prefix. An error that carries a
+// position is followed by the query line it points into, with a caret under
+// the position.
+func printQueryError(prefix, query string, err error) {
+	var (
+		synErr *ast.SyntaxError
+		semErr *ast.SemanticError
+	)
+	switch {
+	case errors.As(err, &synErr):
+		fmt.Fprintf(os.Stderr, "%s: %s at line %d position %d\n", prefix, synErr.Msg, synErr.Token.Line, synErr.Token.Pos)
+		fmt.Fprint(os.Stderr, excerpt(query, synErr.Token.Line, synErr.Token.Pos))
+		if synErr.Hint != "" {
+			fmt.Fprintf(os.Stderr, "hint: %s\n", synErr.Hint)
+		}
+	case errors.As(err, &semErr) && semErr.Line > 0:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
+		fmt.Fprint(os.Stderr, excerpt(query, semErr.Line, semErr.Pos))
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", prefix, err)
 	}
 }
 
-// collectTableNames extracts all table names referenced in a SELECT statement.
-func collectTableNames(sel *ast.SelectStatement) []string {
-	seen := map[string]bool{}
-	var names []string
+// excerpt renders line of query with a caret under the 1-indexed byte position
+// pos, or returns "" if the query has no such line.
+func excerpt(query string, line, pos int) string {
+	lines := strings.Split(query, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	text := strings.TrimRight(lines[line-1], "\r")
+	col := pos - 1
+	if col < 0 {
+		col = 0
+	}
+	if col > len(text) {
+		col = len(text)
+	}
 
-	add := func(name string) {
-		if name != "" && !seen[name] {
-			seen[name] = true
-			names = append(names, name)
+	// Keep tabs so the caret lines up however the terminal expands them.
+	var pad strings.Builder
+	for _, r := range text[:col] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
 		}
 	}
 
-	if sel.From != nil {
-		add(sel.From.Table.Name)
+	num := strconv.Itoa(line)
+	gutter := strings.Repeat(" ", len(num))
+	return fmt.Sprintf(" %s | %s\n %s | %s^\n", num, text, gutter, pad.String())
+}
+
+// collectTableNames extracts all table names referenced in the statements,
+// including those inside derived tables and expression subqueries. Names defined
+// by a WITH clause are not tables and are skipped wherever they are in scope.
+func collectTableNames(stmts []ast.Statement) []string {
+	c := &tableCollector{seen: map[string]bool{}}
+	for i := range stmts {
+		ast.Walk(tableScope{c: c}, &stmts[i])
 	}
-	for _, j := range sel.Joins {
-		add(j.Table.Name)
+	return c.names
+}
+
+type tableCollector struct {
+	seen  map[string]bool // names in lower case
+	names []string
+}
+
+// tableScope visits a subtree of the query, in which the names in ctes refer to
+// common table expressions rather than tables. They are kept in lower case,
+// since SQLite matches names without regard to case.
+type tableScope struct {
+	c    *tableCollector
+	ctes map[string]bool
+}
+
+func (v tableScope) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.SelectStatement:
+		if n.With != nil {
+			scoped := make(map[string]bool, len(v.ctes)+len(n.With.CTEs))
+			for name := range v.ctes {
+				scoped[name] = true
+			}
+			for _, cte := range n.With.CTEs {
+				scoped[strings.ToLower(cte.Name)] = true
+			}
+			v.ctes = scoped
+		}
+	case *ast.TableRef:
+		// A schema-qualified table is read from its schema's source, which
+		// must be given with --source.
+		if n.Name != "" && n.Schema == "" && !v.ctes[strings.ToLower(n.Name)] && !v.c.seen[strings.ToLower(n.Name)] {
+			v.c.seen[strings.ToLower(n.Name)] = true
+			v.c.names = append(v.c.names, n.Name)
+		}
 	}
+	return v
+}
 
-	return names
+// parseJSONParam converts the JSON value of a --param-json flag into a bind
+// argument. Numbers are typed as InferType types them, and objects and arrays
+// are kept as JSON text, the way nested record fields are stored.
+func parseJSONParam(text string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	switch v := v.(type) {
+	case json.Number:
+		return source.InferType(v.String()), nil
+	case map[string]interface{}, []interface{}:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(text)); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	}
+	return v, nil
 }
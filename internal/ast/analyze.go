@@ -0,0 +1,635 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemanticError is a query that parses but cannot be run as written, such as a
+// reference to a column no table in scope has.
+type SemanticError struct {
+	Msg string
+	Position
+}
+
+func (e *SemanticError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s at line %d position %d", e.Msg, e.Line, e.Pos)
+}
+
+func semanticErrorf(pos Position, format string, args ...interface{}) error {
+	return &SemanticError{Msg: fmt.Sprintf(format, args...), Position: pos}
+}
+
+// Analyze checks a parsed statement against the tables it reads from. It
+// resolves the names and aliases in FROM and JOIN, reports table qualifiers that
+// match none of them, and reports columns used outside an aggregate function in
+// a grouped query unless they appear in GROUP BY.
+//
+// schemas maps a table name to its column names. Columns of tables in schemas
+// are checked too; other tables, such as JSON lines whose fields vary from
+// record to record, are assumed to have any column asked of them.
+func Analyze(sel *SelectStatement, schemas map[string][]string) error {
+	a := &analyzer{schemas: make(map[string]map[string]bool, len(schemas))}
+	for name, cols := range schemas {
+		if cols != nil {
+			a.schemas[name] = columnSet(cols)
+		}
+	}
+	return a.selectStmt(sel, nil)
+}
+
+// AnalyzePaths checks only the names the JSON paths in sel start from, each of
+// which must be a table qualifier in scope or a column. It is for schemas
+// learned from the records of sources once read: a mistyped qualifier shows up
+// as a name no record has, while another column no record has may just be a
+// field absent so far, so those are not checked.
+func AnalyzePaths(sel *SelectStatement, schemas map[string][]string) error {
+	a := &analyzer{schemas: make(map[string]map[string]bool, len(schemas)), pathsOnly: true}
+	for name, cols := range schemas {
+		if cols != nil {
+			a.schemas[name] = columnSet(cols)
+		}
+	}
+	return a.selectStmt(sel, nil)
+}
+
+type analyzer struct {
+	schemas   map[string]map[string]bool
+	pathsOnly bool // check only the names paths start from
+}
+
+// scope is the set of tables one SELECT can see. cols is nil for a table whose
+// columns are unknown. aliased maps a table name to the alias that hides it.
+// Table, alias and CTE names are kept in lower case, since SQLite matches them
+// without regard to case.
+type scope struct {
+	tables  map[string]map[string]bool
+	order   []string
+	aliased map[string]string
+	ctes    map[string]map[string]bool
+	outputs map[string]bool
+	outer   *scope
+}
+
+func columnSet(cols []string) map[string]bool {
+	set := make(map[string]bool, len(cols))
+	for _, c := range cols {
+		set[strings.ToLower(c)] = true
+	}
+	return set
+}
+
+// lookupCTE returns the columns of the common table expression name visible
+// from sc, and whether there is one.
+func (sc *scope) lookupCTE(name string) (map[string]bool, bool) {
+	name = strings.ToLower(name)
+	for ; sc != nil; sc = sc.outer {
+		if cols, ok := sc.ctes[name]; ok {
+			return cols, true
+		}
+	}
+	return nil, false
+}
+
+// lookupTable returns the columns of the table or alias name visible from sc,
+// the scope it was found in, and whether it was found.
+func (sc *scope) lookupTable(name string) (map[string]bool, *scope, bool) {
+	name = strings.ToLower(name)
+	for ; sc != nil; sc = sc.outer {
+		if cols, ok := sc.tables[name]; ok {
+			return cols, sc, true
+		}
+	}
+	return nil, nil, false
+}
+
+// hasColumn reports whether some table in sc alone might have column col.
+func (sc *scope) hasColumn(col string) bool {
+	col = strings.ToLower(col)
+	for _, name := range sc.order {
+		if cols := sc.tables[name]; cols == nil || cols[col] {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *analyzer) selectStmt(sel *SelectStatement, outer *scope) error {
+	sc := &scope{
+		tables:  make(map[string]map[string]bool),
+		aliased: make(map[string]string),
+		ctes:    make(map[string]map[string]bool),
+		outputs: make(map[string]bool),
+		outer:   outer,
+	}
+
+	if sel.With != nil {
+		for _, cte := range sel.With.CTEs {
+			cols := columnSet(cte.Columns)
+			if len(cte.Columns) == 0 {
+				cols = outputColumns(cte.Select)
+			}
+			// Registered first so a recursive CTE can refer to itself.
+			sc.ctes[strings.ToLower(cte.Name)] = cols
+			if err := a.selectStmt(cte.Select, sc); err != nil {
+				return err
+			}
+		}
+	}
+
+	var refs []TableRef
+	if sel.From != nil {
+		refs = append(refs, sel.From.Table)
+	}
+	for _, j := range sel.Joins {
+		refs = append(refs, j.Table)
+	}
+	for _, ref := range refs {
+		var cols map[string]bool
+		if ref.Subquery != nil {
+			if err := a.selectStmt(ref.Subquery, sc); err != nil {
+				return err
+			}
+			cols = outputColumns(ref.Subquery)
+		} else if c, ok := sc.lookupCTE(ref.Name); ok && ref.Schema == "" {
+			cols = c
+		} else {
+			cols = a.schemas[ref.QualifiedName()]
+		}
+		key := strings.ToLower(ref.Name)
+		if ref.Alias != "" {
+			key = strings.ToLower(ref.Alias)
+			if ref.Name != "" && !strings.EqualFold(ref.Name, ref.Alias) {
+				sc.aliased[strings.ToLower(ref.Name)] = ref.Alias
+			}
+		}
+		if _, dup := sc.tables[key]; !dup {
+			sc.order = append(sc.order, key)
+		}
+		sc.tables[key] = cols
+	}
+	for _, col := range sel.Columns {
+		if col.Alias != "" {
+			sc.outputs[strings.ToLower(col.Alias)] = true
+		}
+	}
+
+	for _, col := range sel.Columns {
+		if col.Star && col.TableRef != "" {
+			if _, _, ok := sc.lookupTable(col.TableRef); !ok {
+				return semanticErrorf(col.Position, "unknown table %q in %s.*", col.TableRef, col.TableRef)
+			}
+		}
+		if err := a.expr(col.Expr, sc); err != nil {
+			return err
+		}
+	}
+	for _, j := range sel.Joins {
+		if err := a.expr(j.Condition, sc); err != nil {
+			return err
+		}
+		if err := noAggregates(j.Condition, "ON"); err != nil {
+			return err
+		}
+	}
+	if err := a.expr(sel.Where, sc); err != nil {
+		return err
+	}
+	if err := noAggregates(sel.Where, "WHERE"); err != nil {
+		return err
+	}
+	for _, expr := range sel.GroupBy {
+		if err := a.expr(expr, sc); err != nil {
+			return err
+		}
+		if err := noAggregates(expr, "GROUP BY"); err != nil {
+			return err
+		}
+	}
+	if err := a.expr(sel.Having, sc); err != nil {
+		return err
+	}
+	// ORDER BY of a compound SELECT names columns of the combined result.
+	if len(sel.Compound) == 0 {
+		for _, ob := range sel.OrderBy {
+			if err := a.expr(ob.Expr, sc); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkGrouping(sel, sc); err != nil {
+		return err
+	}
+
+	for _, c := range sel.Compound {
+		if err := a.selectStmt(c.Select, outer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expr checks the column references in expr against sc, and any subqueries in
+// it against a scope nested inside sc.
+func (a *analyzer) expr(expr Expression, sc *scope) error {
+	var err error
+	inspectExpr(expr, func(e Expression) bool {
+		if err != nil {
+			return false
+		}
+		switch e := e.(type) {
+		case *ColumnRef:
+			err = a.columnRef(e, sc)
+		case *FunctionExpr:
+			err = checkFunction(e)
+		case *PathExpr:
+			err = a.pathBase(e.Column, sc)
+			return false
+		case *SubqueryExpr:
+			err = a.selectStmt(e.Select, sc)
+		case *ExistsExpr:
+			err = a.selectStmt(e.Subquery, sc)
+		case *InExpr:
+			if e.Subquery != nil {
+				err = a.selectStmt(e.Subquery, sc)
+			}
+		}
+		return true
+	})
+	return err
+}
+
+func (a *analyzer) columnRef(ref *ColumnRef, sc *scope) error {
+	if a.pathsOnly {
+		return nil
+	}
+	if ref.Table != "" {
+		cols, _, ok := sc.lookupTable(ref.Table)
+		if !ok {
+			return semanticErrorf(ref.Position, "unknown table %q", ref.Table)
+		}
+		if ref.Column != "*" && cols != nil && !cols[strings.ToLower(ref.Column)] {
+			return semanticErrorf(ref.Position, "unknown column %q in table %q", ref.Column, ref.Table)
+		}
+		return nil
+	}
+	if a.resolves(ref.Column, sc) {
+		return nil
+	}
+	return semanticErrorf(ref.Position, "unknown column %q", ref.Column)
+}
+
+// pathBase checks the column a JSON path starts from. Its first name may also
+// be a mistyped table qualifier, since resolvePaths reads a.b as key b of the
+// column a whenever no table a is in scope.
+func (a *analyzer) pathBase(ref *ColumnRef, sc *scope) error {
+	if ref.Table != "" {
+		return a.columnRef(ref, sc)
+	}
+	for s := sc; s != nil; s = s.outer {
+		for _, name := range s.order {
+			if cols := s.tables[name]; cols != nil && cols[strings.ToLower(ref.Column)] {
+				return nil
+			}
+		}
+	}
+	for s := sc; s != nil; s = s.outer {
+		if alias, ok := s.aliased[strings.ToLower(ref.Column)]; ok {
+			return semanticErrorf(ref.Position, "unknown table %q (it is aliased as %q)", ref.Column, alias)
+		}
+	}
+	if a.resolves(ref.Column, sc) {
+		return nil
+	}
+	return semanticErrorf(ref.Position, "unknown table or column %q", ref.Column)
+}
+
+// resolves reports whether the unqualified column col might exist: it is an
+// output alias, or some table visible from sc has or may have it.
+func (a *analyzer) resolves(col string, sc *scope) bool {
+	if isSQLKeywordValue(col) {
+		return true
+	}
+	for s := sc; s != nil; s = s.outer {
+		if s.outputs[strings.ToLower(col)] || s.hasColumn(col) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSQLKeywordValue reports whether name is one of the SQLite keywords that
+// read like a column but evaluate to a value.
+func isSQLKeywordValue(name string) bool {
+	switch strings.ToUpper(name) {
+	case "CURRENT_TIMESTAMP", "CURRENT_DATE", "CURRENT_TIME", "ROWID", "OID", "_ROWID_":
+		return true
+	}
+	return false
+}
+
+// outputColumns returns the names of the columns sel produces, or nil when
+// some cannot be known before the query runs, as with * or an unaliased
+// expression.
+func outputColumns(sel *SelectStatement) map[string]bool {
+	var names []string
+	for _, col := range sel.Columns {
+		switch e := col.Expr.(type) {
+		case nil:
+			return nil
+		case *ColumnRef:
+			if col.Alias == "" {
+				names = append(names, e.Column)
+				continue
+			}
+		case *PathExpr:
+			if col.Alias == "" {
+				names = append(names, pathName(e))
+				continue
+			}
+		case *CastExpr:
+			if p, ok := e.Expr.(*PathExpr); ok && col.Alias == "" {
+				names = append(names, pathName(p))
+				continue
+			}
+		}
+		if col.Alias == "" {
+			return nil
+		}
+		names = append(names, col.Alias)
+	}
+	return columnSet(names)
+}
+
+// pathName is the column name the planner gives an unaliased path: its last key.
+func pathName(p *PathExpr) string {
+	for i := len(p.Path) - 1; i >= 0; i-- {
+		if !p.Path[i].IsIndex {
+			return p.Path[i].Key
+		}
+	}
+	return p.Column.Column
+}
+
+// aggregateFuncs are the SQLite aggregate functions. MIN and MAX are
+// aggregates only when called with a single argument.
+var aggregateFuncs = map[string]bool{
+	"COUNT":             true,
+	"SUM":               true,
+	"AVG":               true,
+	"TOTAL":             true,
+	"GROUP_CONCAT":      true,
+	"STRING_AGG":        true,
+	"JSON_GROUP_ARRAY":  true,
+	"JSON_GROUP_OBJECT": true,
+}
+
+// IsAggregate reports whether fn computes one value from a group of rows. A call
+// with an OVER clause is a window function instead.
+func (fn *FunctionExpr) IsAggregate() bool {
+	return fn.Over == nil && fn.aggregates()
+}
+
+// aggregates reports whether fn names an aggregate function, which may also be
+// called as a window function with OVER.
+func (fn *FunctionExpr) aggregates() bool {
+	if fn.Name == "MIN" || fn.Name == "MAX" {
+		return len(fn.Args) == 1
+	}
+	return aggregateFuncs[fn.Name]
+}
+
+// checkFunction reports a DISTINCT or FILTER clause in a call to fn that
+// SQLite would reject.
+func checkFunction(fn *FunctionExpr) error {
+	if fn.Distinct {
+		switch {
+		case !fn.aggregates():
+			return semanticErrorf(fn.Position, "DISTINCT is only allowed in aggregate functions, not %s", fn.Name)
+		case fn.Over != nil:
+			return semanticErrorf(fn.Position, "DISTINCT is not allowed in window function %s", fn.Name)
+		case len(fn.Args) != 1:
+			return semanticErrorf(fn.Position, "%s(DISTINCT ...) takes exactly one argument", fn.Name)
+		}
+	}
+	if fn.Filter != nil {
+		if !fn.aggregates() {
+			return semanticErrorf(fn.Position, "FILTER is only allowed on aggregate functions, not %s", fn.Name)
+		}
+		return noAggregates(fn.Filter, "FILTER")
+	}
+	return nil
+}
+
+// noAggregates reports an aggregate function used in clause, which is evaluated
+// before rows are grouped.
+func noAggregates(expr Expression, clause string) error {
+	var err error
+	inspectExpr(expr, func(e Expression) bool {
+		if fn, ok := e.(*FunctionExpr); ok && err == nil && fn.IsAggregate() {
+			err = semanticErrorf(fn.Position, "aggregate function %s is not allowed in %s", fn.Name, clause)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkGrouping reports a column of a grouped query that is used outside an
+// aggregate function but not grouped by. A query is grouped when it has a
+// GROUP BY clause or calls an aggregate function. Bare columns are allowed
+// alongside a lone MIN or MAX, as SQLite allows them.
+func checkGrouping(sel *SelectStatement, sc *scope) error {
+	exprs := make([]Expression, 0, len(sel.Columns)+len(sel.OrderBy)+1)
+	for _, col := range sel.Columns {
+		if col.Expr != nil {
+			exprs = append(exprs, col.Expr)
+		}
+	}
+	if sel.Having != nil {
+		exprs = append(exprs, sel.Having)
+	}
+	if len(sel.Compound) == 0 {
+		for _, ob := range sel.OrderBy {
+			exprs = append(exprs, ob.Expr)
+		}
+	}
+
+	grouped := len(sel.GroupBy) > 0
+	var aggregates []*FunctionExpr
+	for _, expr := range exprs {
+		inspectExpr(expr, func(e Expression) bool {
+			if fn, ok := e.(*FunctionExpr); ok && fn.IsAggregate() {
+				grouped = true
+				aggregates = append(aggregates, fn)
+				return false
+			}
+			return true
+		})
+	}
+	if !grouped {
+		return nil
+	}
+	// With a single MIN or MAX as its only aggregate, SQLite takes a bare
+	// column from the row that holds the minimum or maximum.
+	if len(aggregates) == 1 && (aggregates[0].Name == "MIN" || aggregates[0].Name == "MAX") {
+		return nil
+	}
+
+	// GROUP BY may name a SELECT item by alias or position.
+	var groupBy []Expression
+	for _, expr := range sel.GroupBy {
+		groupBy = append(groupBy, expr)
+		switch e := expr.(type) {
+		case *ColumnRef:
+			for _, col := range sel.Columns {
+				if e.Table == "" && col.Alias != "" && strings.EqualFold(col.Alias, e.Column) {
+					groupBy = append(groupBy, col.Expr)
+				}
+			}
+		case *LiteralExpr:
+			if n, err := strconv.Atoi(e.Value); err == nil && n >= 1 && n <= len(sel.Columns) {
+				groupBy = append(groupBy, sel.Columns[n-1].Expr)
+			}
+		}
+	}
+	var groupCols []*ColumnRef
+	for _, expr := range groupBy {
+		inspectExpr(expr, func(e Expression) bool {
+			if ref, ok := e.(*ColumnRef); ok {
+				groupCols = append(groupCols, ref)
+			}
+			return true
+		})
+	}
+
+	var err error
+	for _, expr := range exprs {
+		inspectExpr(expr, func(e Expression) bool {
+			if err != nil {
+				return false
+			}
+			for _, g := range groupBy {
+				if exprEqual(e, g) {
+					return false
+				}
+			}
+			switch e := e.(type) {
+			case *FunctionExpr:
+				return !e.IsAggregate()
+			case *ColumnRef:
+				if !isLocalColumn(e, sc) || isGroupedColumn(e, groupCols) {
+					return false
+				}
+				if e.Table == "" && sc.outputs[strings.ToLower(e.Column)] {
+					return false
+				}
+				name := e.Column
+				if e.Table != "" {
+					name = e.Table + "." + e.Column
+				}
+				err = semanticErrorf(e.Position, "column %q must appear in GROUP BY or be used in an aggregate function", name)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLocalColumn reports whether ref may belong to a table of sc itself rather
+// than to the outer query of a correlated subquery.
+func isLocalColumn(ref *ColumnRef, sc *scope) bool {
+	if ref.Table != "" {
+		_, found, _ := sc.lookupTable(ref.Table)
+		return found == sc
+	}
+	return sc.hasColumn(ref.Column) || len(sc.order) == 0
+}
+
+func isGroupedColumn(ref *ColumnRef, groupCols []*ColumnRef) bool {
+	for _, g := range groupCols {
+		if !strings.EqualFold(g.Column, ref.Column) {
+			continue
+		}
+		if g.Table == "" || ref.Table == "" || strings.EqualFold(g.Table, ref.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+// exprEqual reports whether a and b are the same expression, ignoring where
+// they appear in the query. Only the expressions commonly grouped by are
+// compared; any others are reported as different.
+func exprEqual(a, b Expression) bool {
+	switch x := a.(type) {
+	case *ColumnRef:
+		y, ok := b.(*ColumnRef)
+		return ok && x.Table == y.Table && strings.EqualFold(x.Column, y.Column)
+	case *LiteralExpr:
+		y, ok := b.(*LiteralExpr)
+		return ok && x.Type == y.Type && x.Value == y.Value
+	case *ParamExpr:
+		y, ok := b.(*ParamExpr)
+		return ok && x.Index == y.Index
+	case *PathExpr:
+		y, ok := b.(*PathExpr)
+		if !ok || !exprEqual(x.Column, y.Column) || len(x.Path) != len(y.Path) {
+			return false
+		}
+		for i := range x.Path {
+			if x.Path[i] != y.Path[i] {
+				return false
+			}
+		}
+		return true
+	case *FunctionExpr:
+		y, ok := b.(*FunctionExpr)
+		if !ok || x.Name != y.Name || x.Distinct != y.Distinct || x.Over != nil || y.Over != nil || len(x.Args) != len(y.Args) {
+			return false
+		}
+		if (x.Filter == nil) != (y.Filter == nil) || (x.Filter != nil && !exprEqual(x.Filter, y.Filter)) {
+			return false
+		}
+		for i := range x.Args {
+			if !exprEqual(x.Args[i], y.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *BinaryExpr:
+		y, ok := b.(*BinaryExpr)
+		return ok && x.Op == y.Op && exprEqual(x.Left, y.Left) && exprEqual(x.Right, y.Right)
+	case *UnaryExpr:
+		y, ok := b.(*UnaryExpr)
+		return ok && x.Op == y.Op && exprEqual(x.Operand, y.Operand)
+	case *CastExpr:
+		y, ok := b.(*CastExpr)
+		return ok && x.Type == y.Type && exprEqual(x.Expr, y.Expr)
+	}
+	return false
+}
+
+// inspectExpr calls fn for expr and, while fn returns true, for each expression
+// nested inside it. Subqueries are not entered; fn sees the SubqueryExpr,
+// ExistsExpr or InExpr that holds one.
+func inspectExpr(expr Expression, fn func(Expression) bool) {
+	if expr == nil {
+		return
+	}
+	Inspect(expr, func(n Node) bool {
+		switch n := n.(type) {
+		case *SelectStatement:
+			return false
+		case Expression:
+			return fn(n)
+		}
+		return true
+	})
+}
@@ -0,0 +1,175 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SyntaxError is a query that does not parse. Token is where the parser gave
+// up; its Line and Pos place the error in the query text.
+type SyntaxError struct {
+	Token *Token
+	// Expected lists the tokens that would have been accepted in place of
+	// Token, when the parser knows them.
+	Expected []TokenType
+	// Msg describes the error without its position.
+	Msg string
+	// Hint suggests a fix, such as the keyword a misspelled word resembles.
+	Hint string
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("%s at line %d position %d", e.Msg, e.Token.Line, e.Token.Pos)
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+// errorf returns a *SyntaxError at t, with a "did you mean" hint when t or the
+// word before it looks like a misspelled keyword.
+func (p *Parser) errorf(t *Token, expected []TokenType, format string, args ...interface{}) error {
+	return &SyntaxError{
+		Token:    t,
+		Expected: expected,
+		Msg:      fmt.Sprintf(format, args...),
+		Hint:     p.suggest(t, expected),
+	}
+}
+
+// unexpected returns a *SyntaxError for t appearing where one of expected should.
+func (p *Parser) unexpected(t *Token, expected ...TokenType) error {
+	names := make([]string, len(expected))
+	for i, typ := range expected {
+		names[i] = describeToken(typ)
+	}
+	var want string
+	switch len(names) {
+	case 1:
+		want = names[0]
+	case 2:
+		want = names[0] + " or " + names[1]
+	default:
+		want = strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+	}
+	return p.errorf(t, expected, "expected %s but got %q", want, t.String())
+}
+
+// describeToken names typ as a query would spell it: the symbol itself in
+// quotes, or the keyword.
+func describeToken(typ TokenType) string {
+	for _, sym := range symbols {
+		if sym.typ == typ {
+			return "'" + sym.str + "'"
+		}
+	}
+	if kw, ok := keywords[typ]; ok {
+		return kw
+	}
+	return typ.String()
+}
+
+// suggest returns a hint naming the keyword that t, or the word before it, is
+// probably a misspelling of. A misspelled keyword usually parses as a name or
+// alias, so the parser often fails only at the token after it.
+func (p *Parser) suggest(t *Token, expected []TokenType) string {
+	if t.Type == IDENT {
+		if kw := closestKeyword(t.String(), expected); kw != "" {
+			return fmt.Sprintf("did you mean %s?", kw)
+		}
+	}
+	if prev := p.previous(t); prev != nil && prev.Type == IDENT {
+		if kw := closestKeyword(prev.String(), nil); kw != "" {
+			return fmt.Sprintf("did you mean %s instead of %q?", kw, prev.String())
+		}
+	}
+	return ""
+}
+
+// previous returns the last token scanned before t, skipping whitespace and
+// comments, or nil if there is none.
+func (p *Parser) previous(t *Token) *Token {
+	for i := len(p.scanned) - 1; i >= 0; i-- {
+		prev := p.scanned[i]
+		if prev == t || prev.Type == WS || prev.Type == COMMENT {
+			continue
+		}
+		if prev.Line > t.Line || (prev.Line == t.Line && prev.Pos >= t.Pos) {
+			continue
+		}
+		return prev
+	}
+	return nil
+}
+
+// closestKeyword returns the keyword word is most likely a misspelling of, or
+// "" if none is close. Keywords among expected are tried first.
+func closestKeyword(word string, expected []TokenType) string {
+	word = strings.ToUpper(word)
+	if len(word) < 3 {
+		return ""
+	}
+
+	var preferred, all []string
+	for _, typ := range expected {
+		if kw, ok := keywords[typ]; ok {
+			preferred = append(preferred, kw)
+		}
+	}
+	for _, kw := range keywords {
+		all = append(all, kw)
+	}
+	sort.Strings(preferred)
+	sort.Strings(all)
+
+	// Allow one typo in a short word and two in a longer one.
+	limit := editCost
+	if len(word) > 5 {
+		limit = 2 * editCost
+	}
+	for _, candidates := range [][]string{preferred, all} {
+		best, bestDist := "", limit+1
+		for _, kw := range candidates {
+			if d := editDistance(word, kw); d > 0 && d < bestDist {
+				best, bestDist = kw, d
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+	return ""
+}
+
+// editCost is the most a single typo adds to editDistance. Substitutions cost
+// it in full and the other edits cost less, so that WHER is closer to WHERE
+// than to WHEN.
+const editCost = 3
+
+// editDistance is a weighted optimal string alignment distance between a and
+// b: the cost of the single-byte insertions, deletions, substitutions and
+// adjacent transpositions that turn one into the other.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = 2 * i
+	}
+	for j := range d[0] {
+		d[0][j] = 2 * j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			sub := editCost
+			if a[i-1] == b[j-1] {
+				sub = 0
+			}
+			d[i][j] = min(d[i-1][j]+2, d[i][j-1]+2, d[i-1][j-1]+sub)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+2)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,514 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format returns the canonical text of stmts. Each clause starts a line, a SELECT
+// list of more than one column puts each column on its own line, subqueries are
+// indented, and keywords are upper-cased. Every statement ends with a semicolon.
+// Comments are written back before the clause, column, join or CTE they preceded,
+// or at the end of the line when they followed other text on theirs. The result
+// parses back to the same statements.
+func Format(stmts []Statement) string {
+	f := &formatter{}
+	for i, stmt := range stmts {
+		comments := stmt.Comments
+		if i > 0 {
+			// Comments after the previous statement's semicolon stay on its line.
+			n := 0
+			for n < len(comments) && comments[n].Trailing {
+				n++
+			}
+			f.comments(0, comments[:n])
+			comments = comments[n:]
+			f.lines = append(f.lines, "")
+		}
+		f.names = tableNames(stmt.Select)
+		f.comments(0, comments)
+		if stmt.Explain {
+			f.lines = append(f.lines, "EXPLAIN")
+		}
+		f.selectStmt(stmt.Select, 0)
+		f.lines[len(f.lines)-1] += ";"
+		f.comments(0, stmt.Select.Comments[ClauseEnd])
+	}
+	if len(f.lines) == 0 {
+		return ""
+	}
+	return strings.Join(f.lines, "\n") + "\n"
+}
+
+// String returns the canonical text of s, as Format writes it but without the
+// terminating semicolon.
+func (s *SelectStatement) String() string {
+	f := &formatter{names: tableNames(s)}
+	f.selectStmt(s, 0)
+	f.comments(0, s.Comments[ClauseEnd])
+	return strings.Join(f.lines, "\n")
+}
+
+// FormatExpr returns the canonical text of a single expression.
+func FormatExpr(expr Expression) string {
+	f := &formatter{names: map[string]bool{}}
+	return f.expr(expr)
+}
+
+const indentUnit = "  "
+
+type formatter struct {
+	lines []string
+	// names holds every table name and alias in the statement. A JSON path on a
+	// column with one of these names is written with a subscript, so that it
+	// does not read back as a qualified column.
+	names map[string]bool
+}
+
+// line adds text at the given depth. Text spanning several lines, such as an
+// expression holding a subquery, is indented as a whole.
+func (f *formatter) line(depth int, text string) {
+	pad := strings.Repeat(indentUnit, depth)
+	for _, l := range strings.Split(text, "\n") {
+		f.lines = append(f.lines, pad+l)
+	}
+}
+
+// comments adds comments at the given depth. A trailing comment goes at the end
+// of the previous line unless that line already ends in one.
+func (f *formatter) comments(depth int, comments []Comment) {
+	for _, c := range comments {
+		if last := len(f.lines) - 1; c.Trailing && last >= 0 && !strings.Contains(f.lines[last], "--") {
+			f.lines[last] += " " + c.Text
+			continue
+		}
+		f.line(depth, c.Text)
+	}
+}
+
+// selectStmt adds the lines of s, other than the comments after its last clause.
+func (f *formatter) selectStmt(s *SelectStatement, depth int) {
+	if s.With != nil {
+		head := "WITH"
+		if s.With.Recursive {
+			head += " RECURSIVE"
+		}
+		f.line(depth, head)
+		for i, cte := range s.With.CTEs {
+			f.comments(depth+1, cte.Comments)
+			text := quoteName(cte.Name)
+			if len(cte.Columns) > 0 {
+				text += " (" + quoteNames(cte.Columns) + ")"
+			}
+			text += " AS " + f.subquery(cte.Select)
+			if i < len(s.With.CTEs)-1 {
+				text += ","
+			}
+			f.line(depth+1, text)
+		}
+	}
+
+	f.selectCore(s, depth)
+	for _, c := range s.Compound {
+		f.comments(depth, c.Comments)
+		f.line(depth, setOpText(c.Op))
+		f.selectCore(c.Select, depth)
+	}
+
+	if len(s.OrderBy) > 0 {
+		f.comments(depth, s.Comments[ClauseOrderBy])
+		f.line(depth, "ORDER BY "+f.orderBy(s.OrderBy))
+	}
+	if s.Limit != nil {
+		f.comments(depth, s.Comments[ClauseLimit])
+		text := fmt.Sprintf("LIMIT %d", *s.Limit)
+		if s.Offset != nil {
+			text += fmt.Sprintf(" OFFSET %d", *s.Offset)
+		}
+		f.line(depth, text)
+	}
+	if s.Over > 0 {
+		f.comments(depth, s.Comments[ClauseOver])
+		f.line(depth, "OVER "+formatDuration(s.Over))
+	}
+	if s.Every > 0 {
+		f.comments(depth, s.Comments[ClauseEvery])
+		f.line(depth, "EVERY "+formatDuration(s.Every))
+	}
+}
+
+// selectCore adds the SELECT through HAVING clauses of s.
+func (f *formatter) selectCore(s *SelectStatement, depth int) {
+	f.comments(depth, s.Comments[ClauseSelect])
+	head := "SELECT"
+	if s.Distinct {
+		head += " DISTINCT"
+	}
+
+	oneLine := len(s.Columns) == 1 && len(s.Columns[0].Comments) == 0
+	if oneLine {
+		f.line(depth, head+" "+f.column(s.Columns[0]))
+	} else {
+		f.line(depth, head)
+		for i, col := range s.Columns {
+			f.comments(depth+1, col.Comments)
+			text := f.column(col)
+			if i < len(s.Columns)-1 {
+				text += ","
+			}
+			f.line(depth+1, text)
+		}
+	}
+
+	if s.From != nil {
+		f.comments(depth, s.Comments[ClauseFrom])
+		f.line(depth, "FROM "+f.tableRef(s.From.Table))
+	}
+	for i, j := range s.Joins {
+		if j.Type == CommaJoin {
+			// FROM a, b stays on one line unless a join or comment intervenes,
+			// in which case the table goes on a line of its own, indented under
+			// the comma that ends the line before.
+			last := len(f.lines) - 1
+			if (i == 0 || s.Joins[i-1].Type == CommaJoin) && len(j.Comments) == 0 {
+				f.lines[last] += ", " + f.tableRef(j.Table)
+			} else {
+				f.lines[last] += ","
+				f.comments(depth+1, j.Comments)
+				f.line(depth+1, f.tableRef(j.Table))
+			}
+			continue
+		}
+		f.comments(depth, j.Comments)
+		text := joinText(j.Type) + " " + f.tableRef(j.Table)
+		switch {
+		case j.Condition != nil:
+			text += " ON " + f.expr(j.Condition)
+		case len(j.Using) > 0:
+			text += " USING (" + quoteNames(j.Using) + ")"
+		}
+		f.line(depth, text)
+	}
+	if s.Where != nil {
+		f.comments(depth, s.Comments[ClauseWhere])
+		f.line(depth, "WHERE "+f.expr(s.Where))
+	}
+	if len(s.GroupBy) > 0 {
+		f.comments(depth, s.Comments[ClauseGroupBy])
+		f.line(depth, "GROUP BY "+f.exprList(s.GroupBy))
+	}
+	if s.Having != nil {
+		f.comments(depth, s.Comments[ClauseHaving])
+		f.line(depth, "HAVING "+f.expr(s.Having))
+	}
+}
+
+func (f *formatter) column(col Column) string {
+	switch {
+	case col.Star && col.TableRef != "":
+		return quoteName(col.TableRef) + ".*"
+	case col.Star:
+		return "*"
+	case col.Alias != "":
+		return f.expr(col.Expr) + " AS " + quoteName(col.Alias)
+	}
+	return f.expr(col.Expr)
+}
+
+func (f *formatter) tableRef(t TableRef) string {
+	if t.Subquery != nil {
+		return f.subquery(t.Subquery) + " " + quoteName(t.Alias)
+	}
+	name := quoteName(t.Name)
+	if t.Schema != "" {
+		name = quoteName(t.Schema) + "." + name
+	}
+	if t.Alias != "" {
+		return name + " " + quoteName(t.Alias)
+	}
+	return name
+}
+
+// subquery returns s in parentheses, its lines indented one level.
+func (f *formatter) subquery(s *SelectStatement) string {
+	sub := &formatter{names: f.names}
+	sub.selectStmt(s, 1)
+	sub.comments(1, s.Comments[ClauseEnd])
+	return "(\n" + strings.Join(sub.lines, "\n") + "\n)"
+}
+
+func (f *formatter) orderBy(orders []OrderByExpr) string {
+	parts := make([]string, len(orders))
+	for i, ob := range orders {
+		parts[i] = f.expr(ob.Expr)
+		if ob.Desc {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f *formatter) exprList(exprs []Expression) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = f.expr(e)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// expr returns the text of e, with only the parentheses its precedence needs.
+func (f *formatter) expr(e Expression) string {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		prec := infixPrecedence(e.Op)
+		return f.operand(e.Left, prec) + " " + opText(e.Op) + " " + f.operand(e.Right, prec+1)
+	case *UnaryExpr:
+		if e.Op == NOT {
+			return "NOT " + f.operand(e.Operand, precedenceNOT)
+		}
+		operand := f.operand(e.Operand, precedenceUnary)
+		if strings.HasPrefix(operand, "-") || strings.HasPrefix(operand, "+") {
+			operand = "(" + operand + ")" // keep "- -x" from reading as a comment
+		}
+		return opText(e.Op) + operand
+	case *FunctionExpr:
+		text := e.Name + "("
+		if e.Distinct {
+			text += "DISTINCT "
+		}
+		text += f.exprList(e.Args) + ")"
+		if e.Filter != nil {
+			text += " FILTER (WHERE " + f.expr(e.Filter) + ")"
+		}
+		if e.Over != nil {
+			text += " OVER (" + f.windowSpec(e.Over) + ")"
+		}
+		return text
+	case *ColumnRef:
+		if e.Table != "" {
+			return quoteName(e.Table) + "." + quoteName(e.Column)
+		}
+		return quoteName(e.Column)
+	case *PathExpr:
+		return f.path(e)
+	case *LiteralExpr:
+		switch e.Type {
+		case TIMESTAMP, DATE, INTERVAL:
+			return e.Type.String() + " " + e.Value
+		}
+		return e.Value
+	case *ParamExpr:
+		if e.Name != "" {
+			return ":" + e.Name
+		}
+		return "$" + strconv.Itoa(e.Index)
+	case *StarExpr:
+		return "*"
+	case *IsNullExpr:
+		text := f.operand(e.Expr, precedenceComparison) + " IS "
+		if e.Not {
+			text += "NOT "
+		}
+		return text + "NULL"
+	case *BetweenExpr:
+		text := f.operand(e.Expr, precedenceComparison)
+		if e.Not {
+			text += " NOT"
+		}
+		return text + " BETWEEN " + f.operand(e.Low, precedenceComparison+1) + " AND " + f.operand(e.High, precedenceComparison+1)
+	case *InExpr:
+		text := f.operand(e.Expr, precedenceComparison)
+		if e.Not {
+			text += " NOT"
+		}
+		if e.Subquery != nil {
+			return text + " IN " + f.subquery(e.Subquery)
+		}
+		return text + " IN (" + f.exprList(e.Values) + ")"
+	case *LikeExpr:
+		text := f.operand(e.Expr, precedenceComparison)
+		if e.Not {
+			text += " NOT"
+		}
+		return text + " " + opText(e.Op) + " " + f.operand(e.Pattern, precedenceComparison+1)
+	case *CaseExpr:
+		text := "CASE"
+		if e.Operand != nil {
+			text += " " + f.expr(e.Operand)
+		}
+		for _, w := range e.Whens {
+			text += " WHEN " + f.expr(w.Cond) + " THEN " + f.expr(w.Result)
+		}
+		if e.Else != nil {
+			text += " ELSE " + f.expr(e.Else)
+		}
+		return text + " END"
+	case *CastExpr:
+		return "CAST(" + f.expr(e.Expr) + " AS " + e.Type + ")"
+	case *SubqueryExpr:
+		return f.subquery(e.Select)
+	case *ExistsExpr:
+		return "EXISTS " + f.subquery(e.Subquery)
+	}
+	return ""
+}
+
+// operand returns the text of e as an operand that must bind at least as
+// tightly as minPrec, parenthesized if it does not.
+func (f *formatter) operand(e Expression, minPrec int) string {
+	if exprPrecedence(e) < minPrec {
+		return "(" + f.expr(e) + ")"
+	}
+	return f.expr(e)
+}
+
+// exprPrecedence returns how tightly e binds, on the scale of infixPrecedence.
+func exprPrecedence(e Expression) int {
+	switch e := e.(type) {
+	case *BinaryExpr:
+		return infixPrecedence(e.Op)
+	case *UnaryExpr:
+		if e.Op == NOT {
+			return precedenceNOT
+		}
+		return precedenceUnary
+	case *IsNullExpr, *BetweenExpr, *InExpr, *LikeExpr:
+		return precedenceComparison
+	}
+	return precedenceCast + 1
+}
+
+func (f *formatter) path(e *PathExpr) string {
+	text := f.expr(e.Column)
+	for i, step := range e.Path {
+		switch {
+		case step.IsIndex:
+			text += fmt.Sprintf("[%d]", step.Index)
+		case isIdentKey(step.Key) && !(i == 0 && e.Column.Table == "" && f.names[strings.ToLower(e.Column.Column)]):
+			text += "." + step.Key
+		default:
+			text += "['" + strings.ReplaceAll(step.Key, "'", `\'`) + "']"
+		}
+	}
+	return text
+}
+
+// isIdentKey reports whether key can follow a dot in a path.
+func isIdentKey(key string) bool {
+	for i, ch := range key {
+		if !(ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || (i > 0 && '0' <= ch && ch <= '9')) {
+			return false
+		}
+	}
+	return key != ""
+}
+
+func (f *formatter) windowSpec(spec *WindowSpec) string {
+	var parts []string
+	if len(spec.PartitionBy) > 0 {
+		parts = append(parts, "PARTITION BY "+f.exprList(spec.PartitionBy))
+	}
+	if len(spec.OrderBy) > 0 {
+		parts = append(parts, "ORDER BY "+f.orderBy(spec.OrderBy))
+	}
+	if fr := spec.Frame; fr != nil {
+		if fr.End == nil {
+			parts = append(parts, fr.Unit+" "+f.frameBound(fr.Start))
+		} else {
+			parts = append(parts, fr.Unit+" BETWEEN "+f.frameBound(fr.Start)+" AND "+f.frameBound(*fr.End))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *formatter) frameBound(b FrameBound) string {
+	switch b.Kind {
+	case UnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case Preceding:
+		return f.expr(b.Offset) + " PRECEDING"
+	case CurrentRow:
+		return "CURRENT ROW"
+	case Following:
+		return f.expr(b.Offset) + " FOLLOWING"
+	default:
+		return "UNBOUNDED FOLLOWING"
+	}
+}
+
+func opText(op TokenType) string {
+	switch op {
+	case EQ:
+		return "="
+	case NEQ:
+		return "!="
+	case AND, OR, NOT, LIKE, ILIKE, GLOB, REGEXP:
+		return keywords[op]
+	}
+	for _, sym := range symbols {
+		if sym.typ == op {
+			return sym.str
+		}
+	}
+	return op.String()
+}
+
+func setOpText(op SetOp) string {
+	switch op {
+	case UnionAll:
+		return "UNION ALL"
+	case Intersect:
+		return "INTERSECT"
+	case Except:
+		return "EXCEPT"
+	default:
+		return "UNION"
+	}
+}
+
+func joinText(typ JoinType) string {
+	switch typ {
+	case LeftJoin:
+		return "LEFT JOIN"
+	case RightJoin:
+		return "RIGHT JOIN"
+	case FullJoin:
+		return "FULL JOIN"
+	case CrossJoin:
+		return "CROSS JOIN"
+	default:
+		return "JOIN"
+	}
+}
+
+// formatDuration writes d the way it would be typed, as 5m rather than 5m0s.
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// tableNames returns the names and aliases of every table s and its subqueries
+// read from, in lower case.
+func tableNames(s *SelectStatement) map[string]bool {
+	names := make(map[string]bool)
+	Inspect(s, func(n Node) bool {
+		if ref, ok := n.(*TableRef); ok {
+			if ref.Name != "" {
+				names[strings.ToLower(ref.Name)] = true
+			}
+			if ref.Alias != "" {
+				names[strings.ToLower(ref.Alias)] = true
+			}
+		}
+		return true
+	})
+	return names
+}
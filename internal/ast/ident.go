@@ -0,0 +1,77 @@
+package ast
+
+import "strings"
+
+// identQuotes maps each character that opens a quoted identifier to the one
+// that closes it: "name" as in standard SQL, `name` as in MySQL and [name] as
+// in SQL Server, all of which SQLite accepts.
+var identQuotes = map[byte]byte{'"': '"', '`': '`', '[': ']'}
+
+// splitIdent splits the text of an IDENT token into its dot-separated parts,
+// removing the quotes from quoted parts. Dots inside quotes do not split.
+func splitIdent(raw string) []string {
+	var parts []string
+	for {
+		var part string
+		part, raw = nextIdentPart(raw)
+		parts = append(parts, part)
+		if !strings.HasPrefix(raw, ".") {
+			return parts
+		}
+		raw = raw[1:]
+	}
+}
+
+// nextIdentPart returns the first part of raw, unquoted, and the rest of raw.
+func nextIdentPart(raw string) (string, string) {
+	if raw == "" {
+		return "", ""
+	}
+	closing, quoted := identQuotes[raw[0]]
+	if !quoted {
+		if i := strings.IndexByte(raw, '.'); i >= 0 {
+			return raw[:i], raw[i:]
+		}
+		return raw, ""
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(raw); i++ {
+		switch {
+		case raw[i] == '\\' && closing != ']' && i+1 < len(raw) && raw[i+1] == closing:
+			b.WriteByte(closing)
+			i++
+		case raw[i] == closing && closing != ']' && i+1 < len(raw) && raw[i+1] == closing:
+			b.WriteByte(closing) // doubled to escape it
+			i++
+		case raw[i] == closing:
+			return b.String(), raw[i+1:]
+		default:
+			b.WriteByte(raw[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// identName returns the name an IDENT token spells, without quotes.
+func identName(t *Token) string {
+	return strings.Join(splitIdent(t.String()), ".")
+}
+
+// quoteName returns name as it must be written in a query: as is if it is a
+// plain word, and double-quoted otherwise.
+func quoteName(name string) string {
+	if isIdentKey(name) && !isKeyword(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteNames quotes each of names as quoteName does and joins them with commas.
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteName(name)
+	}
+	return strings.Join(quoted, ", ")
+}
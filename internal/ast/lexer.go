@@ -22,6 +22,8 @@ type Lexer struct {
 	line int
 	pos  int
 	eof  bool
+	err  error     // returned by every Scan after the first failure
+	last TokenType // type of the token Scan returned last
 }
 
 // NewLexer returns a new instance of Lexer.
@@ -36,6 +38,9 @@ func NewLexer(r io.Reader) *Lexer {
 
 // Scan returns the next token and literal value.
 func (l *Lexer) Scan() (*Token, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
 	for _, scan := range []func() (*Token, error){
 		l.scanEOF,
 		l.scanComment,
@@ -43,15 +48,18 @@ func (l *Lexer) Scan() (*Token, error) {
 		l.scanString,
 		l.scanDuration,
 		l.scanNumeric,
+		l.scanParam,
 		l.scanSymbol,
 		l.scanKeyword,
 		l.scanIdent,
 	} {
 		tok, err := scan()
 		if err != nil {
+			l.err = err
 			return nil, err
 		}
 		if tok != nil {
+			l.last = tok.Type
 			return tok, nil
 		}
 	}
@@ -107,12 +115,20 @@ func (l *Lexer) scanEOF() (*Token, error) {
 	return l.newToken(EOF, nil)
 }
 
+// scanComment scans a "--" comment to the end of its line, a "/* */" block
+// comment, or a "#!" line at the very start of the input, which lets a query
+// file be run as a script.
 func (l *Lexer) scanComment() (*Token, error) {
 	peek, err := l.peekN(2)
 	if err != nil {
 		return nil, err
 	}
-	if string(peek) != "--" {
+	switch {
+	case string(peek) == "/*":
+		return l.scanBlockComment()
+	case string(peek) == "--":
+	case string(peek) == "#!" && len(l.loc) == 1 && l.loc[0] == 1:
+	default:
 		return nil, nil
 	}
 	var raw []byte
@@ -131,6 +147,28 @@ func (l *Lexer) scanComment() (*Token, error) {
 	}
 }
 
+func (l *Lexer) scanBlockComment() (*Token, error) {
+	line, pos := len(l.loc), l.loc[len(l.loc)-1]
+	raw, err := l.readN(2)
+	if err != nil {
+		return nil, err
+	}
+	for !strings.HasSuffix(string(raw), "*/") || len(raw) < 4 {
+		ch, err := l.read()
+		if err != nil {
+			return nil, err
+		}
+		if ch == eof {
+			return nil, &SyntaxError{
+				Token: &Token{Type: ILLEGAL, Raw: []byte("/*"), Line: line, Pos: pos},
+				Msg:   "unterminated comment",
+			}
+		}
+		raw = append(raw, ch)
+	}
+	return l.newToken(COMMENT, raw)
+}
+
 func (l *Lexer) scanWS() (*Token, error) {
 	ch, err := l.read()
 	if err != nil {
@@ -176,9 +214,13 @@ func (l *Lexer) scanString() (*Token, error) {
 
 	switch quote {
 	case '\'':
+		line, pos := len(l.loc), l.loc[len(l.loc)-1]
 		raw, err := l.scanQuote()
 		if err != nil {
-			return nil, err
+			return nil, &SyntaxError{
+				Token: &Token{Type: ILLEGAL, Raw: []byte{quote}, Line: line, Pos: pos},
+				Msg:   err.Error(),
+			}
 		}
 		return l.newToken(STRING, raw)
 	default:
@@ -330,7 +372,50 @@ loop:
 	return l.newToken(NUMERIC, raw)
 }
 
+// scanParam scans a query parameter: ":name", "$1", "?" or "?1". A colon
+// followed by another is the :: cast operator, not a parameter.
+func (l *Lexer) scanParam() (*Token, error) {
+	peek, err := l.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	var accept func(ch byte, i int) bool
+	switch peek {
+	case '?', '$':
+		accept = func(ch byte, i int) bool { return isDigit(ch) }
+	case ':':
+		accept = func(ch byte, i int) bool { return isIdent(ch) && (i > 0 || !isDigit(ch)) }
+	default:
+		return nil, nil
+	}
+
+	n := 1
+	for {
+		ch, err := l.peekAfter(n)
+		if err != nil {
+			return nil, err
+		}
+		if !accept(ch, n-1) {
+			break
+		}
+		n++
+	}
+	if n == 1 && peek != '?' {
+		return nil, nil
+	}
+
+	raw, err := l.readN(n)
+	if err != nil {
+		return nil, err
+	}
+	return l.newToken(PARAM, raw)
+}
+
 func (l *Lexer) scanSymbol() (*Token, error) {
+	if peek, _ := l.peek(); peek == '[' && l.isBracketIdent() {
+		return nil, nil // left to scanIdent
+	}
 	for _, sym := range symbols {
 		n := len([]byte(sym.str))
 
@@ -391,12 +476,18 @@ func (l *Lexer) scanIdent() (t *Token, e error) {
 	if err != nil {
 		return nil, err
 	}
-	if peek == '"' {
+	switch {
+	case peek == '"' || peek == '`':
 		raw, err = l.scanQuote()
 		if err != nil {
 			return nil, err
 		}
-	} else {
+	case peek == '[' && l.isBracketIdent():
+		raw, err = l.scanBracketIdent()
+		if err != nil {
+			return nil, err
+		}
+	default:
 		for i := 0; ; i++ {
 			peek, err := l.peekAfter(i)
 			if err != nil {
@@ -420,31 +511,49 @@ func (l *Lexer) scanIdent() (t *Token, e error) {
 		}
 	}
 
-	dot, err := l.read()
+	dot, err := l.peek()
 	if err != nil {
-		e = err
-		return
+		return nil, err
 	}
-	if dot != '.' {
-		if err := l.unread(); err != nil {
-			return nil, err
-		}
+	// Leave the dot alone unless a valid ident follows it. It can't be unread
+	// once the suffix has been peeked at.
+	if dot != '.' || !l.identAfterDot() {
 		return l.newToken(IDENT, raw)
 	}
+	if _, err := l.read(); err != nil {
+		return nil, err
+	}
 
 	suffix, err := l.scanIdent()
-	if suffix == nil {
-		// No valid ident after dot — put the dot back and return what we have
-		if err := l.unread(); err != nil {
-			return nil, err
-		}
-		return l.newToken(IDENT, raw)
+	if err != nil {
+		return nil, err
 	}
 	raw = append(raw, '.')
 	raw = append(raw, suffix.Raw...)
 	return l.newToken(IDENT, raw)
 }
 
+// identAfterDot reports whether the bytes following the next '.' form an ident
+// that scanIdent would accept: a quoted name, or a word that is not a keyword.
+func (l *Lexer) identAfterDot() bool {
+	var word []byte
+	for i := 1; ; i++ {
+		ch, _ := l.peekAfter(i)
+		if i == 1 && (ch == '"' || ch == '`') {
+			return true
+		}
+		if i == 1 && ch == '[' {
+			next, _ := l.peekAfter(2)
+			return opensBracketIdent(next)
+		}
+		if !isIdent(ch) {
+			break
+		}
+		word = append(word, ch)
+	}
+	return len(word) > 0 && !isKeyword(string(word))
+}
+
 func (l *Lexer) scanQuote() ([]byte, error) {
 	quote, err := l.read()
 	if err != nil {
@@ -472,7 +581,9 @@ func (l *Lexer) scanQuote() ([]byte, error) {
 			}
 			n, ok := escapeChars[escaped]
 			if !ok {
-				return nil, fmt.Errorf("unkown escape sequence: '\\%s'", string(escaped))
+				// Kept as written, as SQLite reads it, so regular
+				// expressions such as '\d+' need no doubled backslashes.
+				continue
 			}
 			seq, err := l.readN(n)
 			if err != nil {
@@ -481,13 +592,55 @@ func (l *Lexer) scanQuote() ([]byte, error) {
 			raw = append(raw, seq...)
 		case quote:
 			raw = append(raw, quote)
-			return raw, nil
+			// A doubled quote stands for one quote character.
+			if next, err := l.peek(); err != nil || next != quote {
+				return raw, err
+			}
+			l.read()
+			raw = append(raw, quote)
 		default:
 			raw = append(raw, ch)
 		}
 	}
 }
 
+// scanBracketIdent scans a [bracketed] identifier, which has no escapes.
+func (l *Lexer) scanBracketIdent() ([]byte, error) {
+	var raw []byte
+	for {
+		ch, err := l.read()
+		if err != nil {
+			return nil, err
+		}
+		if ch == eof {
+			return nil, fmt.Errorf("mismatched bracket")
+		}
+		raw = append(raw, ch)
+		if ch == ']' {
+			return raw, nil
+		}
+	}
+}
+
+// isBracketIdent reports whether the '[' that is next opens a [bracketed]
+// identifier rather than a subscript such as ['key'] or [0], whose contents
+// start with a quote or digit. A '[' right after a name or a closing paren or
+// bracket is always a subscript.
+func (l *Lexer) isBracketIdent() bool {
+	switch l.last {
+	case IDENT, RPAREN, RBRACKET:
+		return false
+	}
+	ch, _ := l.peekAfter(1)
+	return opensBracketIdent(ch)
+}
+
+// opensBracketIdent reports whether ch, following a '[', starts a bracketed
+// identifier.
+func opensBracketIdent(ch byte) bool {
+	return ch != '\'' && ch != ']' && ch != eof && !isDigit(ch) && !isWS(ch)
+}
+
 func (l *Lexer) scanIllegal() (*Token, error) {
 	ch, err := l.read()
 	if err != nil {
@@ -649,6 +802,11 @@ func isKeyword(pattern string) bool {
 	return false
 }
 
+func isKeywordToken(typ TokenType) bool {
+	_, ok := keywords[typ]
+	return ok
+}
+
 type symbolEntry struct {
 	typ TokenType
 	str string
@@ -658,6 +816,12 @@ var (
 	// Ordered longest-first so multi-char symbols match before single-char prefixes.
 	symbols = []symbolEntry{
 		{NEQ, "!="},
+		{NEQ, "<>"},
+		{EQ, "=="},
+		{COLONCOLON, "::"},
+		{CONCAT, "||"},
+		{LSHIFT, "<<"},
+		{RSHIFT, ">>"},
 		{LTE, "<="},
 		{GTE, ">="},
 		{STAR, "*"},
@@ -675,42 +839,68 @@ var (
 		{SLASH, "/"},
 		{PERCENT, "%"},
 		{SEMICOLON, ";"},
+		{AMPERSAND, "&"},
+		{PIPE, "|"},
+		{TILDE, "~"},
 	}
 
 	keywords = map[TokenType]string{
-		SELECT:   "SELECT",
-		DISTINCT: "DISTINCT",
-		COUNT:    "COUNT",
-		SUM:      "SUM",
-		MAX:      "MAX",
-		MIN:      "MIN",
-		AVG:      "AVG",
-		AS:       "AS",
-		FROM:     "FROM",
-		OVER:     "OVER",
-		WHERE:    "WHERE",
-		AND:      "AND",
-		OR:       "OR",
-		NOT:      "NOT",
-		IN:       "IN",
-		IS:       "IS",
-		BETWEEN:  "BETWEEN",
-		WITHIN:   "WITHIN",
-		GROUP:    "GROUP",
-		BY:       "BY",
-		ORDER:    "ORDER",
-		ASC:      "ASC",
-		DESC:     "DESC",
-		EVERY:    "EVERY",
-		LIMIT:    "LIMIT",
-		NULL:     "NULL",
-		TRUE:     "TRUE",
-		FALSE:    "FALSE",
-		JOIN:     "JOIN",
-		ON:       "ON",
-		LEFT:     "LEFT",
-		RIGHT:    "RIGHT",
-		LIKE:     "LIKE",
+		SELECT:    "SELECT",
+		DISTINCT:  "DISTINCT",
+		COUNT:     "COUNT",
+		SUM:       "SUM",
+		MAX:       "MAX",
+		MIN:       "MIN",
+		AVG:       "AVG",
+		AS:        "AS",
+		FROM:      "FROM",
+		OVER:      "OVER",
+		WHERE:     "WHERE",
+		AND:       "AND",
+		OR:        "OR",
+		NOT:       "NOT",
+		IN:        "IN",
+		IS:        "IS",
+		BETWEEN:   "BETWEEN",
+		WITHIN:    "WITHIN",
+		GROUP:     "GROUP",
+		BY:        "BY",
+		HAVING:    "HAVING",
+		ORDER:     "ORDER",
+		ASC:       "ASC",
+		DESC:      "DESC",
+		EVERY:     "EVERY",
+		LIMIT:     "LIMIT",
+		NULL:      "NULL",
+		TRUE:      "TRUE",
+		FALSE:     "FALSE",
+		JOIN:      "JOIN",
+		ON:        "ON",
+		LEFT:      "LEFT",
+		RIGHT:     "RIGHT",
+		LIKE:      "LIKE",
+		ILIKE:     "ILIKE",
+		GLOB:      "GLOB",
+		REGEXP:    "REGEXP",
+		CASE:      "CASE",
+		WHEN:      "WHEN",
+		THEN:      "THEN",
+		ELSE:      "ELSE",
+		END:       "END",
+		CAST:      "CAST",
+		EXISTS:    "EXISTS",
+		WITH:      "WITH",
+		RECURSIVE: "RECURSIVE",
+		UNION:     "UNION",
+		ALL:       "ALL",
+		INTERSECT: "INTERSECT",
+		EXCEPT:    "EXCEPT",
+		INNER:     "INNER",
+		OUTER:     "OUTER",
+		FULL:      "FULL",
+		CROSS:     "CROSS",
+		USING:     "USING",
+		EXPLAIN:   "EXPLAIN",
 	}
 
 	escapeChars = map[byte]int{
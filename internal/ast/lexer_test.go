@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -48,3 +49,164 @@ func TestLexerSymbolOrder(t *testing.T) {
 		t.Errorf("expected GTE, got %s (%q)", tokens[1].Type, string(tokens[1].Raw))
 	}
 }
+
+func TestLexerPatternStrings(t *testing.T) {
+	input := `a ILIKE 'x%' AND b ~ '^\d+\.\w*$' AND c NOT GLOB 'y*' AND d REGEXP '\''`
+	l := NewLexer(strings.NewReader(input))
+	var got []string
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		if tok.Type != WS && tok.Type != IDENT && tok.Type != AND {
+			got = append(got, tok.Type.String()+":"+tok.String())
+		}
+	}
+	if want := `[ILIKE:ILIKE STRING:'x%' TILDE:~ STRING:'^\d+\.\w*$' NOT:NOT GLOB:GLOB STRING:'y*' REGEXP:REGEXP STRING:'\'']`; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestLexerOperators(t *testing.T) {
+	input := "a || b | c & d << e >> f ~g == h <> i <= j"
+	want := []TokenType{
+		IDENT, CONCAT, IDENT, PIPE, IDENT, AMPERSAND, IDENT, LSHIFT, IDENT, RSHIFT,
+		IDENT, TILDE, IDENT, EQ, IDENT, NEQ, IDENT, LTE, IDENT,
+	}
+	l := NewLexer(strings.NewReader(input))
+	var got []TokenType
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		if tok.Type == WS {
+			continue
+		}
+		got = append(got, tok.Type)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestLexerKeywordAfterDot(t *testing.T) {
+	// A keyword after a dot ends the ident; the dot and keyword follow as tokens.
+	input := "e.payload.count"
+	l := NewLexer(strings.NewReader(input))
+	var got []string
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		got = append(got, tok.Type.String()+":"+tok.String())
+	}
+	if want := "[IDENT:e.payload DOT:. COUNT:count]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestLexerQuotedIdents(t *testing.T) {
+	// [ opens a bracketed name unless it starts a subscript.
+	input := "\"a\"\"b\".`c d`.[e.f] [g] tags[0] x['k'] 'it''s'"
+	l := NewLexer(strings.NewReader(input))
+	var got []string
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		if tok.Type != WS {
+			got = append(got, tok.Type.String()+":"+tok.String())
+		}
+	}
+	want := "[IDENT:\"a\"\"b\".`c d`.[e.f] IDENT:[g] IDENT:tags LBRACKET:[ NUMERIC:0 RBRACKET:] IDENT:x LBRACKET:[ STRING:'k' RBRACKET:] STRING:'it''s']"
+	if fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+	if parts := splitIdent(got[0][len("IDENT:"):]); fmt.Sprintf("%q", parts) != `["a\"b" "c d" "e.f"]` {
+		t.Errorf("expected parts a\"b, c d and e.f, got %q", parts)
+	}
+}
+
+func TestLexerParams(t *testing.T) {
+	input := "a = :user_id AND b::INTEGER > $2 OR c IN (?, ?7) AND d = :1"
+	l := NewLexer(strings.NewReader(input))
+	var got []string
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		if tok.Type == PARAM || tok.Type == COLONCOLON || tok.Type == ILLEGAL {
+			got = append(got, tok.Type.String()+":"+tok.String())
+		}
+	}
+	if want := "[PARAM::user_id COLONCOLON::: PARAM:$2 PARAM:? PARAM:?7 ILLEGAL::]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestLexerComments(t *testing.T) {
+	input := "#!/usr/bin/env -S csql -f\nSELECT /* a\nb */ x -- c\nFROM t /**/"
+	l := NewLexer(strings.NewReader(input))
+	var got []string
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		if tok.Type == COMMENT {
+			got = append(got, fmt.Sprintf("%d:%d %s", tok.Line, tok.Pos, tok.Raw))
+		}
+	}
+	want := []string{"1:1 #!/usr/bin/env -S csql -f", "2:8 /* a\nb */", "3:8 -- c", "4:8 /**/"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// A shebang is only a comment on the first line.
+	l = NewLexer(strings.NewReader("SELECT 1 #!x"))
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+		if tok.Type == COMMENT {
+			t.Errorf("unexpected comment %q", tok.Raw)
+		}
+		if tok.Type == EOF || tok.Type == ILLEGAL {
+			break
+		}
+	}
+
+	_, err := NewParser(strings.NewReader("SELECT 1 /* open")).Parse()
+	if want := "unterminated comment at line 1 position 10"; err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
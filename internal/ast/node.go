@@ -2,31 +2,111 @@ package ast
 
 import "time"
 
-// Statement is a top-level SQL statement.
+// Statement is a top-level SQL statement. Comments are those before it.
+// Explain is set for "EXPLAIN SELECT ...", which describes how the SELECT
+// would run instead of running it.
 type Statement struct {
-	Select *SelectStatement
+	Select   *SelectStatement
+	Explain  bool
+	Comments []Comment
+}
+
+// Comment is a comment from the query text, kept so Format can write it back.
+// Text includes the comment marker. Trailing is set when the comment followed
+// other text on its line.
+type Comment struct {
+	Text     string
+	Trailing bool
 }
 
+// Clause identifies a clause of a SELECT, for placing the comments before it.
+type Clause int
+
+const (
+	ClauseSelect Clause = iota
+	ClauseFrom
+	ClauseWhere
+	ClauseGroupBy
+	ClauseHaving
+	ClauseOrderBy
+	ClauseLimit
+	ClauseOver
+	ClauseEvery
+	ClauseEnd // after the last clause
+)
+
 // SelectStatement represents a full SELECT query.
 type SelectStatement struct {
+	With     *WithClause
 	Distinct bool
 	Columns  []Column
 	From     *FromClause
 	Joins    []JoinClause
 	Where    Expression
 	GroupBy  []Expression
+	Having   Expression
+	Compound []CompoundSelect // further SELECTs combined with set operators
 	OrderBy  []OrderByExpr
 	Limit    *int
+	Offset   *int
 	Over     time.Duration
 	Every    time.Duration
+	// Comments holds the comments before each clause, other than those kept
+	// with a column, join, CTE or set operator.
+	Comments map[Clause][]Comment
+}
+
+func (s *SelectStatement) addComments(c Clause, comments []Comment) {
+	if len(comments) == 0 {
+		return
+	}
+	if s.Comments == nil {
+		s.Comments = make(map[Clause][]Comment)
+	}
+	s.Comments[c] = append(s.Comments[c], comments...)
+}
+
+// CompoundSelect is a SELECT combined with the preceding one by a set operator.
+// Its Select holds only the core clauses (columns through HAVING); ORDER BY,
+// LIMIT, OVER and EVERY on the leading SelectStatement apply to the whole result.
+type CompoundSelect struct {
+	Op       SetOp
+	Select   *SelectStatement
+	Comments []Comment
+}
+
+// SetOp is a set operator joining the members of a compound SELECT.
+type SetOp int
+
+const (
+	Union SetOp = iota
+	UnionAll
+	Intersect
+	Except
+)
+
+// WithClause holds the common table expressions that precede a SELECT.
+type WithClause struct {
+	Recursive bool
+	CTEs      []CTE
+}
+
+// CTE is a single "name [(columns)] AS (SELECT ...)" in a WITH clause.
+type CTE struct {
+	Name     string
+	Columns  []string
+	Select   *SelectStatement
+	Comments []Comment
 }
 
 // Column represents a single item in the SELECT list.
 type Column struct {
-	Star      bool
-	TableRef  string // table alias for "t.*"
-	Expr      Expression
-	Alias     string
+	Star     bool
+	TableRef string // table alias for "t.*"
+	Expr     Expression
+	Alias    string
+	Comments []Comment
+	Position
 }
 
 // FromClause represents the FROM clause.
@@ -34,17 +114,31 @@ type FromClause struct {
 	Table TableRef
 }
 
-// TableRef is a table name with optional alias.
+// TableRef is a table name with optional alias, or a derived table: a
+// parenthesized subquery, in which case Name is empty and Alias is required.
 type TableRef struct {
-	Name  string
-	Alias string
+	Schema   string // set for schema.table, naming the source the table is in
+	Name     string
+	Alias    string
+	Subquery *SelectStatement
 }
 
-// JoinClause represents a JOIN.
+// QualifiedName returns the table's name prefixed with its schema, if any.
+func (t *TableRef) QualifiedName() string {
+	if t.Schema != "" {
+		return t.Schema + "." + t.Name
+	}
+	return t.Name
+}
+
+// JoinClause represents a JOIN. Joins other than CROSS and comma joins have
+// either an ON Condition or a USING column list.
 type JoinClause struct {
 	Type      JoinType
 	Table     TableRef
 	Condition Expression
+	Using     []string
+	Comments  []Comment
 }
 
 type JoinType int
@@ -53,6 +147,9 @@ const (
 	InnerJoin JoinType = iota
 	LeftJoin
 	RightJoin
+	FullJoin
+	CrossJoin
+	CommaJoin // FROM a, b
 )
 
 // OrderByExpr is a single ORDER BY expression.
@@ -63,6 +160,7 @@ type OrderByExpr struct {
 
 // Expression is a node in an expression tree.
 type Expression interface {
+	Node
 	exprNode()
 }
 
@@ -84,29 +182,101 @@ type UnaryExpr struct {
 func (*UnaryExpr) exprNode() {}
 
 // FunctionExpr represents a function call like COUNT(x), SUM(x), UPPER(x).
+// Distinct is set for an aggregate over distinct values, as in
+// COUNT(DISTINCT user), and Filter holds the condition of a
+// FILTER (WHERE ...) clause. Over is set when the call is an analytic window
+// function, as in ROW_NUMBER() OVER (PARTITION BY user ORDER BY ts).
 type FunctionExpr struct {
-	Name string
-	Args []Expression
+	Name     string
+	Distinct bool
+	Args     []Expression
+	Filter   Expression
+	Over     *WindowSpec
+	Position
 }
 
 func (*FunctionExpr) exprNode() {}
 
+// WindowSpec is the parenthesized OVER clause of an analytic function call. It is
+// unrelated to the statement-level OVER duration, which sets the tumbling window.
+type WindowSpec struct {
+	PartitionBy []Expression
+	OrderBy     []OrderByExpr
+	Frame       *WindowFrame
+}
+
+// WindowFrame is a ROWS, RANGE or GROUPS frame clause. End is nil when the frame
+// has only a starting bound, in which case it ends at the current row.
+type WindowFrame struct {
+	Unit  string
+	Start FrameBound
+	End   *FrameBound
+}
+
+// FrameBoundKind identifies the kind of a window frame bound.
+type FrameBoundKind int
+
+const (
+	UnboundedPreceding FrameBoundKind = iota
+	Preceding
+	CurrentRow
+	Following
+	UnboundedFollowing
+)
+
+// FrameBound is one end of a window frame. Offset is set for Preceding and
+// Following bounds only.
+type FrameBound struct {
+	Kind   FrameBoundKind
+	Offset Expression
+}
+
+// Position is where a node starts in the query text, taken from the Line and
+// Pos of its first token. It is zero for nodes built outside the parser.
+type Position struct {
+	Line int
+	Pos  int
+}
+
 // ColumnRef is a reference to a column, possibly qualified (table.column).
 type ColumnRef struct {
 	Table  string
 	Column string
+	Position
 }
 
 func (*ColumnRef) exprNode() {}
 
-// LiteralExpr is a literal value.
+// LiteralExpr is a literal value. The Value of a TIMESTAMP, DATE or INTERVAL
+// literal is its quoted string, without the word before it.
 type LiteralExpr struct {
-	Type  TokenType // STRING, NUMERIC, TRUE, FALSE, NULL
+	Type  TokenType // STRING, NUMERIC, DURATION, TRUE, FALSE, NULL, TIMESTAMP, DATE, INTERVAL
 	Value string
 }
 
 func (*LiteralExpr) exprNode() {}
 
+// Unquoted returns the text of a STRING literal without its quotes and escapes.
+func (e *LiteralExpr) Unquoted() string {
+	return unquoteString(e.Value)
+}
+
+// ParamExpr is a query parameter, ":name", "$1", "?" or "?1", whose value is
+// bound when the query runs. Name is empty for positional parameters. A bare
+// "?" is numbered one past the highest positional parameter before it.
+//
+// Index numbers the distinct parameters of a statement from 1, and is how the
+// generated SQL refers to each. For a positional parameter it is the
+// parameter's own number; named parameters follow the highest of those.
+type ParamExpr struct {
+	Name  string
+	Index int
+	Text  string // the parameter as written, e.g. "?" or "$1"
+	Position
+}
+
+func (*ParamExpr) exprNode() {}
+
 // StarExpr represents * in expressions (e.g., COUNT(*)).
 type StarExpr struct{}
 
@@ -130,20 +300,81 @@ type BetweenExpr struct {
 
 func (*BetweenExpr) exprNode() {}
 
-// InExpr represents "expr [NOT] IN (values...)".
+// InExpr represents "expr [NOT] IN (values...)" or "expr [NOT] IN (SELECT ...)".
+// Exactly one of Values and Subquery is set.
 type InExpr struct {
-	Expr   Expression
-	Values []Expression
-	Not    bool
+	Expr     Expression
+	Values   []Expression
+	Subquery *SelectStatement
+	Not      bool
 }
 
 func (*InExpr) exprNode() {}
 
-// LikeExpr represents "expr [NOT] LIKE pattern".
+// LikeExpr represents "expr NOT LIKE pattern", or the same with ILIKE, GLOB or
+// REGEXP as Op. Without NOT, a pattern match is a BinaryExpr.
 type LikeExpr struct {
+	Op      TokenType // LIKE, ILIKE, GLOB or REGEXP
 	Expr    Expression
 	Pattern Expression
 	Not     bool
 }
 
 func (*LikeExpr) exprNode() {}
+
+// CaseExpr represents "CASE [operand] WHEN ... THEN ... [ELSE ...] END".
+// Operand is nil for the searched form, where each WHEN is a boolean condition.
+type CaseExpr struct {
+	Operand Expression
+	Whens   []WhenClause
+	Else    Expression
+}
+
+func (*CaseExpr) exprNode() {}
+
+// WhenClause is a single "WHEN cond THEN result" arm of a CASE expression.
+type WhenClause struct {
+	Cond   Expression
+	Result Expression
+}
+
+// CastExpr represents "CAST(expr AS type)" or the shorthand "expr::type".
+// Type is the upper-cased target type: INTEGER, REAL, TEXT, BOOLEAN, or JSON.
+type CastExpr struct {
+	Expr Expression
+	Type string
+}
+
+func (*CastExpr) exprNode() {}
+
+// SubqueryExpr is a parenthesized SELECT used as a scalar value.
+type SubqueryExpr struct {
+	Select *SelectStatement
+}
+
+func (*SubqueryExpr) exprNode() {}
+
+// ExistsExpr represents "EXISTS (SELECT ...)". NOT EXISTS parses as a UnaryExpr around it.
+type ExistsExpr struct {
+	Subquery *SelectStatement
+}
+
+func (*ExistsExpr) exprNode() {}
+
+// PathExpr extracts a value from a column holding JSON, as in payload.user.id,
+// payload['user']['id'] or tags[0]. Nested objects and arrays in records are
+// stored as JSON text, so this is how their fields are reached.
+type PathExpr struct {
+	Column *ColumnRef
+	Path   []PathStep
+}
+
+func (*PathExpr) exprNode() {}
+
+// PathStep is one step of a PathExpr: an object key, or an array index when
+// IsIndex is set.
+type PathStep struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
@@ -0,0 +1,44 @@
+package ast
+
+// maxParams is the highest parameter number SQLite accepts by default.
+const maxParams = 32766
+
+// numberParams gives each distinct named parameter in s an Index following
+// highest, the highest positional parameter, in order of first appearance.
+func numberParams(s *SelectStatement, highest int) {
+	named := make(map[string]int)
+	Inspect(s, func(n Node) bool {
+		if param, ok := n.(*ParamExpr); ok && param.Name != "" {
+			if _, ok := named[param.Name]; !ok {
+				highest++
+				named[param.Name] = highest
+			}
+			param.Index = named[param.Name]
+		}
+		return true
+	})
+}
+
+// Params returns one parameter for each distinct Index in s and its
+// subqueries, ordered by Index.
+func (s *SelectStatement) Params() []*ParamExpr {
+	byIndex := make(map[int]*ParamExpr)
+	highest := 0
+	Inspect(s, func(n Node) bool {
+		if param, ok := n.(*ParamExpr); ok {
+			if _, ok := byIndex[param.Index]; !ok {
+				byIndex[param.Index] = param
+			}
+			highest = max(highest, param.Index)
+		}
+		return true
+	})
+
+	var params []*ParamExpr
+	for i := 1; i <= highest; i++ {
+		if param, ok := byIndex[i]; ok {
+			params = append(params, param)
+		}
+	}
+	return params
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -39,7 +40,14 @@ func (p *Parser) parsePrecedence(minPrec int) (Expression, error) {
 			}
 			left = &BinaryExpr{Op: t.Type, Left: left, Right: right}
 
-		case EQ, NEQ, LT, LTE, GT, GTE, LIKE:
+		case EQ, NEQ, LT, LTE, GT, GTE, LIKE, ILIKE, GLOB, REGEXP, TILDE:
+			right, err := p.parsePrecedence(prec + 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{Op: t.Type, Left: left, Right: right}
+
+		case AMPERSAND, PIPE, LSHIFT, RSHIFT:
 			right, err := p.parsePrecedence(prec + 1)
 			if err != nil {
 				return nil, err
@@ -60,6 +68,13 @@ func (p *Parser) parsePrecedence(minPrec int) (Expression, error) {
 			}
 			left = &BinaryExpr{Op: t.Type, Left: left, Right: right}
 
+		case CONCAT:
+			right, err := p.parsePrecedence(prec + 1)
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{Op: t.Type, Left: left, Right: right}
+
 		case IS:
 			left, err = p.parseIsExpr(left)
 			if err != nil {
@@ -84,8 +99,15 @@ func (p *Parser) parsePrecedence(minPrec int) (Expression, error) {
 				return nil, err
 			}
 
+		case COLONCOLON:
+			typ, err := p.parseCastType()
+			if err != nil {
+				return nil, err
+			}
+			left = &CastExpr{Expr: left, Type: typ}
+
 		default:
-			return left, nil
+			return nil, p.errorf(t, nil, "unsupported operator %q", t.String())
 		}
 	}
 }
@@ -104,14 +126,24 @@ func (p *Parser) parseUnary() (Expression, error) {
 		}
 		return &UnaryExpr{Op: NOT, Operand: operand}, nil
 
-	case MINUS:
+	case MINUS, PLUS, TILDE:
 		operand, err := p.parsePrecedence(precedenceUnary)
 		if err != nil {
 			return nil, err
 		}
-		return &UnaryExpr{Op: MINUS, Operand: operand}, nil
+		return &UnaryExpr{Op: t.Type, Operand: operand}, nil
 
 	case LPAREN:
+		if next, _ := p.peek(); next.Type == SELECT || next.Type == WITH {
+			sub, err := p.parseSubquery(t)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(RPAREN); err != nil {
+				return nil, err
+			}
+			return &SubqueryExpr{Select: sub}, nil
+		}
 		expr, err := p.parseExpression()
 		if err != nil {
 			return nil, err
@@ -122,14 +154,25 @@ func (p *Parser) parseUnary() (Expression, error) {
 		return expr, nil
 
 	case IDENT:
+		if typ, ok := typedLiterals[strings.ToUpper(t.String())]; ok {
+			if next, _ := p.peek(); next.Type == STRING {
+				return p.parseTypedLiteral(typ)
+			}
+		}
 		return p.parseIdentOrFunction(t)
 
 	case NUMERIC:
 		return &LiteralExpr{Type: NUMERIC, Value: t.String()}, nil
 
+	case DURATION:
+		return &LiteralExpr{Type: DURATION, Value: t.String()}, nil
+
 	case STRING:
 		return &LiteralExpr{Type: STRING, Value: t.String()}, nil
 
+	case PARAM:
+		return p.parseParam(t)
+
 	case TRUE:
 		return &LiteralExpr{Type: TRUE, Value: "TRUE"}, nil
 
@@ -142,25 +185,38 @@ func (p *Parser) parseUnary() (Expression, error) {
 	case STAR:
 		return &StarExpr{}, nil
 
-	// Aggregate/function keywords used as function names
-	case COUNT, SUM, AVG, MIN, MAX:
-		return p.parseFunctionCall(strings.ToUpper(t.String()))
+	case CASE:
+		return p.parseCaseExpr()
+
+	case CAST:
+		return p.parseCastExpr()
+
+	case EXISTS:
+		lparen, err := p.expect(LPAREN)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := p.parseSubquery(lparen)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(RPAREN); err != nil {
+			return nil, err
+		}
+		return &ExistsExpr{Subquery: sub}, nil
+
+	// Aggregate and pattern keywords used as function names
+	case COUNT, SUM, AVG, MIN, MAX, GLOB, REGEXP:
+		return p.parseFunctionCall(strings.ToUpper(t.String()), Position{Line: t.Line, Pos: t.Pos})
 
 	default:
-		return nil, fmt.Errorf("unexpected token %q at line %d position %d", t.String(), t.Line, t.Pos)
+		return nil, p.errorf(t, nil, "unexpected token %q", t.String())
 	}
 }
 
 func (p *Parser) parseIdentOrFunction(ident *Token) (Expression, error) {
 	name := ident.String()
-
-	// The lexer may have already consumed "table.column" as a single IDENT token.
-	// Split on dot to handle qualified names.
-	if dotIdx := strings.IndexByte(name, '.'); dotIdx >= 0 {
-		table := name[:dotIdx]
-		col := name[dotIdx+1:]
-		return &ColumnRef{Table: table, Column: col}, nil
-	}
+	pos := Position{Line: ident.Line, Pos: ident.Pos}
 
 	t, err := p.peek()
 	if err != nil {
@@ -168,60 +224,157 @@ func (p *Parser) parseIdentOrFunction(ident *Token) (Expression, error) {
 	}
 
 	// Check for function call: ident(
-	if t.Type == LPAREN {
+	// The lexer may have already consumed "table.column" or "column.key.key" as a
+	// single IDENT token. Split on dots to handle qualified names and paths.
+	parts := splitIdent(name)
+
+	// Check for function call: ident(
+	if t.Type == LPAREN && len(parts) == 1 {
 		p.scanSkipWS() // consume (
-		return p.parseFunctionArgs(strings.ToUpper(name))
+		return p.parseFunctionArgs(strings.ToUpper(parts[0]), pos)
 	}
 
-	// Check for qualified name: ident.ident or ident.*
-	if t.Type == DOT {
+	// A dot the lexer left separate precedes * or a keyword used as a name
+	for t.Type == DOT {
 		p.scanSkipWS() // consume .
 		next, err := p.scanSkipWS()
 		if err != nil {
 			return nil, err
 		}
-		if next.Type == IDENT {
-			return &ColumnRef{Table: name, Column: next.String()}, nil
+		switch {
+		case next.Type == STAR && len(parts) == 1:
+			return &ColumnRef{Table: parts[0], Column: "*", Position: pos}, nil
+		case next.Type == IDENT:
+			parts = append(parts, splitIdent(next.String())...)
+		case isKeywordToken(next.Type):
+			parts = append(parts, next.String())
+		default:
+			return nil, p.errorf(next, []TokenType{IDENT, STAR}, "expected identifier or * after '.' but got %q", next.String())
+		}
+		if t, err = p.peek(); err != nil {
+			return nil, err
 		}
-		if next.Type == STAR {
-			return &ColumnRef{Table: name, Column: "*"}, nil
+	}
+
+	var expr Expression
+	switch len(parts) {
+	case 1:
+		expr = &ColumnRef{Column: parts[0], Position: pos}
+	case 2:
+		expr = &ColumnRef{Table: parts[0], Column: parts[1], Position: pos}
+	default:
+		// Treat the first part as a table for now; resolvePaths decides once
+		// the tables in scope are known.
+		path := &PathExpr{Column: &ColumnRef{Table: parts[0], Column: parts[1], Position: pos}}
+		for _, key := range parts[2:] {
+			path.Path = append(path.Path, PathStep{Key: key})
 		}
-		return nil, fmt.Errorf("expected identifier or * after '.' but got %q at line %d position %d", next.String(), next.Line, next.Pos)
+		expr = path
 	}
 
-	return &ColumnRef{Column: name}, nil
+	return p.parseSubscripts(expr)
 }
 
-func (p *Parser) parseFunctionCall(name string) (Expression, error) {
+// parseSubscripts parses any ['key'] or [index] subscripts after a column
+// reference, along with .key steps that follow them.
+func (p *Parser) parseSubscripts(expr Expression) (Expression, error) {
+	var steps []PathStep
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Type == DOT && len(steps) > 0 {
+			p.scanSkipWS() // consume .
+			next, err := p.scanSkipWS()
+			if err != nil {
+				return nil, err
+			}
+			if next.Type != IDENT && !isKeywordToken(next.Type) {
+				return nil, p.errorf(next, []TokenType{IDENT}, "expected key after '.' but got %q", next.String())
+			}
+			for _, key := range splitIdent(next.String()) {
+				steps = append(steps, PathStep{Key: key})
+			}
+			continue
+		}
+
+		if t.Type != LBRACKET {
+			break
+		}
+		p.scanSkipWS() // consume [
+
+		sub, err := p.scanSkipWS()
+		if err != nil {
+			return nil, err
+		}
+		switch sub.Type {
+		case STRING:
+			steps = append(steps, PathStep{Key: unquoteString(sub.String())})
+		case NUMERIC:
+			n, err := strconv.Atoi(sub.String())
+			if err != nil || n < 0 {
+				return nil, p.errorf(sub, nil, "invalid array index %q", sub.String())
+			}
+			steps = append(steps, PathStep{Index: n, IsIndex: true})
+		default:
+			return nil, p.errorf(sub, []TokenType{STRING, NUMERIC}, "expected string key or array index but got %q", sub.String())
+		}
+		if _, err := p.expect(RBRACKET); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(steps) == 0 {
+		return expr, nil
+	}
+	switch e := expr.(type) {
+	case *ColumnRef:
+		return &PathExpr{Column: e, Path: steps}, nil
+	case *PathExpr:
+		e.Path = append(e.Path, steps...)
+		return e, nil
+	}
+	return expr, nil
+}
+
+// unquoteString strips the quotes from a single-quoted string literal.
+func unquoteString(s string) string {
+	s = s[1 : len(s)-1]
+	s = strings.ReplaceAll(s, `\'`, `'`)
+	return strings.ReplaceAll(s, `''`, `'`)
+}
+
+func (p *Parser) parseFunctionCall(name string, pos Position) (Expression, error) {
 	if _, err := p.expect(LPAREN); err != nil {
 		return nil, err
 	}
-	return p.parseFunctionArgs(name)
+	return p.parseFunctionArgs(name, pos)
 }
 
 // parseFunctionArgs parses function arguments after the opening paren has been consumed.
-func (p *Parser) parseFunctionArgs(name string) (Expression, error) {
+func (p *Parser) parseFunctionArgs(name string, pos Position) (Expression, error) {
 	t, err := p.scanSkipWS()
 	if err != nil {
 		return nil, err
 	}
 	if t.Type == RPAREN {
-		return &FunctionExpr{Name: name, Args: nil}, nil
+		return p.parseWindowSuffix(&FunctionExpr{Name: name, Args: nil, Position: pos})
 	}
-	p.unscan()
 
 	// Check for * argument (COUNT(*))
-	t, err = p.scanSkipWS()
-	if err != nil {
-		return nil, err
-	}
 	if t.Type == STAR {
 		if _, err := p.expect(RPAREN); err != nil {
 			return nil, err
 		}
-		return &FunctionExpr{Name: name, Args: []Expression{&StarExpr{}}}, nil
+		return p.parseWindowSuffix(&FunctionExpr{Name: name, Args: []Expression{&StarExpr{}}, Position: pos})
+	}
+
+	distinct := t.Type == DISTINCT
+	if !distinct {
+		p.unscan()
 	}
-	p.unscan()
 
 	var args []Expression
 	for {
@@ -239,11 +392,322 @@ func (p *Parser) parseFunctionArgs(name string) (Expression, error) {
 			break
 		}
 		if t.Type != COMMA {
-			return nil, fmt.Errorf("expected ',' or ')' but got %q at line %d position %d", t.String(), t.Line, t.Pos)
+			return nil, p.unexpected(t, COMMA, RPAREN)
+		}
+	}
+
+	return p.parseWindowSuffix(&FunctionExpr{Name: name, Distinct: distinct, Args: args, Position: pos})
+}
+
+// parseWindowSuffix parses an optional "FILTER (WHERE ...)" clause and then an
+// optional "OVER (...)" window spec after a function call. A bare OVER followed
+// by anything other than a paren is left in place, since it is the
+// statement-level tumbling window duration.
+func (p *Parser) parseWindowSuffix(fn *FunctionExpr) (Expression, error) {
+	filter, next, err := p.peekPair()
+	if err != nil {
+		return nil, err
+	}
+	if filter.Type == IDENT && strings.EqualFold(filter.String(), "FILTER") && next.Type == LPAREN {
+		p.scanSkipWS() // consume FILTER
+		p.scanSkipWS() // consume (
+		if _, err := p.expect(WHERE); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(RPAREN); err != nil {
+			return nil, err
+		}
+		fn.Filter = cond
+	}
+
+	over, next, err := p.peekPair()
+	if err != nil {
+		return nil, err
+	}
+	if over.Type != OVER || next.Type != LPAREN {
+		return fn, nil
+	}
+	p.scanSkipWS() // consume OVER
+	p.scanSkipWS() // consume (
+
+	spec := &WindowSpec{}
+	if p.peekWord("PARTITION") {
+		p.scanSkipWS()
+		if _, err := p.expect(BY); err != nil {
+			return nil, err
+		}
+		exprs, err := p.parseExpressionList()
+		if err != nil {
+			return nil, err
+		}
+		spec.PartitionBy = exprs
+	}
+	if t, _ := p.peek(); t.Type == ORDER {
+		p.scanSkipWS()
+		if _, err := p.expect(BY); err != nil {
+			return nil, err
+		}
+		orders, err := p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+		spec.OrderBy = orders
+	}
+	if p.peekWord("ROWS") || p.peekWord("RANGE") || p.peekWord("GROUPS") {
+		frame, err := p.parseWindowFrame()
+		if err != nil {
+			return nil, err
+		}
+		spec.Frame = frame
+	}
+	if _, err := p.expect(RPAREN); err != nil {
+		return nil, err
+	}
+
+	fn.Over = spec
+	return fn, nil
+}
+
+// parseWindowFrame parses "ROWS|RANGE|GROUPS bound" or
+// "ROWS|RANGE|GROUPS BETWEEN bound AND bound".
+func (p *Parser) parseWindowFrame() (*WindowFrame, error) {
+	unit, err := p.scanSkipWS()
+	if err != nil {
+		return nil, err
+	}
+	frame := &WindowFrame{Unit: strings.ToUpper(unit.String())}
+
+	if t, _ := p.peek(); t.Type != BETWEEN {
+		start, err := p.parseFrameBound()
+		if err != nil {
+			return nil, err
 		}
+		frame.Start = *start
+		return frame, nil
 	}
+	p.scanSkipWS() // consume BETWEEN
 
-	return &FunctionExpr{Name: name, Args: args}, nil
+	start, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(AND); err != nil {
+		return nil, err
+	}
+	end, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	frame.Start = *start
+	frame.End = end
+	return frame, nil
+}
+
+// parseFrameBound parses UNBOUNDED PRECEDING, UNBOUNDED FOLLOWING, CURRENT ROW,
+// or "expr PRECEDING|FOLLOWING".
+func (p *Parser) parseFrameBound() (*FrameBound, error) {
+	if p.peekWord("UNBOUNDED") {
+		p.scanSkipWS()
+		t, err := p.scanSkipWS()
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToUpper(t.String()) {
+		case "PRECEDING":
+			return &FrameBound{Kind: UnboundedPreceding}, nil
+		case "FOLLOWING":
+			return &FrameBound{Kind: UnboundedFollowing}, nil
+		}
+		return nil, p.errorf(t, nil, "expected PRECEDING or FOLLOWING but got %q", t.String())
+	}
+
+	if p.peekWord("CURRENT") {
+		p.scanSkipWS()
+		t, err := p.scanSkipWS()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type != IDENT || !strings.EqualFold(t.String(), "ROW") {
+			return nil, p.errorf(t, nil, "expected ROW but got %q", t.String())
+		}
+		return &FrameBound{Kind: CurrentRow}, nil
+	}
+
+	offset, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.scanSkipWS()
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToUpper(t.String()) {
+	case "PRECEDING":
+		return &FrameBound{Kind: Preceding, Offset: offset}, nil
+	case "FOLLOWING":
+		return &FrameBound{Kind: Following, Offset: offset}, nil
+	}
+	return nil, p.errorf(t, nil, "expected PRECEDING or FOLLOWING but got %q", t.String())
+}
+
+// parseCaseExpr parses a CASE expression after the CASE keyword has been consumed.
+func (p *Parser) parseCaseExpr() (Expression, error) {
+	expr := &CaseExpr{}
+
+	// Simple CASE has an operand before the first WHEN
+	if t, _ := p.peek(); t.Type != WHEN {
+		operand, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expr.Operand = operand
+	}
+
+	for {
+		t, err := p.scanSkipWS()
+		if err != nil {
+			return nil, err
+		}
+		switch t.Type {
+		case WHEN:
+			cond, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(THEN); err != nil {
+				return nil, err
+			}
+			result, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			expr.Whens = append(expr.Whens, WhenClause{Cond: cond, Result: result})
+
+		case ELSE:
+			if len(expr.Whens) == 0 {
+				return nil, p.errorf(t, []TokenType{WHEN}, "expected WHEN before ELSE")
+			}
+			els, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			expr.Else = els
+			if _, err := p.expect(END); err != nil {
+				return nil, err
+			}
+			return expr, nil
+
+		case END:
+			if len(expr.Whens) == 0 {
+				return nil, p.errorf(t, []TokenType{WHEN}, "expected WHEN before END")
+			}
+			return expr, nil
+
+		default:
+			return nil, p.unexpected(t, WHEN, ELSE, END)
+		}
+	}
+}
+
+// parseParam converts a PARAM token into a ParamExpr. Named parameters are
+// numbered once the whole statement has been parsed; see numberParams.
+func (p *Parser) parseParam(t *Token) (Expression, error) {
+	raw := t.String()
+	param := &ParamExpr{Text: raw, Position: Position{Line: t.Line, Pos: t.Pos}}
+	switch {
+	case raw[0] == ':':
+		param.Name = raw[1:]
+		return param, nil
+	case raw == "?":
+		param.Index = p.params + 1
+	default:
+		n, err := strconv.Atoi(raw[1:])
+		if err != nil || n < 1 || n > maxParams {
+			return nil, p.errorf(t, nil, "parameter number must be between 1 and %d but got %q", maxParams, raw)
+		}
+		param.Index = n
+	}
+	p.params = max(p.params, param.Index)
+	return param, nil
+}
+
+// parseCastExpr parses "(expr AS type)" after the CAST keyword has been consumed.
+func (p *Parser) parseCastExpr() (Expression, error) {
+	if _, err := p.expect(LPAREN); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(AS); err != nil {
+		return nil, err
+	}
+	typ, err := p.parseCastType()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(RPAREN); err != nil {
+		return nil, err
+	}
+	return &CastExpr{Expr: expr, Type: typ}, nil
+}
+
+// parseCastType parses the target type name of a CAST or :: conversion.
+func (p *Parser) parseCastType() (string, error) {
+	t, err := p.expect(IDENT)
+	if err != nil {
+		return "", err
+	}
+	typ := strings.ToUpper(t.String())
+	if !castTypes[typ] {
+		return "", &SyntaxError{
+			Token: t,
+			Msg:   fmt.Sprintf("unknown cast type %q", t.String()),
+			Hint:  "expected INTEGER, REAL, TEXT, BOOLEAN, JSON, or TIMESTAMP",
+		}
+	}
+	return typ, nil
+}
+
+var castTypes = map[string]bool{
+	"INTEGER":   true,
+	"REAL":      true,
+	"TEXT":      true,
+	"BOOLEAN":   true,
+	"JSON":      true,
+	"TIMESTAMP": true,
+}
+
+var typedLiterals = map[string]TokenType{
+	"TIMESTAMP": TIMESTAMP,
+	"DATE":      DATE,
+	"INTERVAL":  INTERVAL,
+}
+
+// parseTypedLiteral parses the string of a TIMESTAMP, DATE or INTERVAL literal,
+// whose word has been consumed, and checks that it holds a value of the type.
+func (p *Parser) parseTypedLiteral(typ TokenType) (Expression, error) {
+	t, err := p.expect(STRING)
+	if err != nil {
+		return nil, err
+	}
+	lit := &LiteralExpr{Type: typ, Value: t.String()}
+	switch typ {
+	case INTERVAL:
+		if _, err := lit.Duration(); err != nil {
+			return nil, p.errorf(t, nil, "invalid interval %s: %v", t.String(), err)
+		}
+	default:
+		if _, err := lit.Time(); err != nil {
+			return nil, p.errorf(t, nil, "invalid %s %s: %v", typ, t.String(), err)
+		}
+	}
+	return lit, nil
 }
 
 func (p *Parser) parseIsExpr(left Expression) (Expression, error) {
@@ -260,7 +724,7 @@ func (p *Parser) parseIsExpr(left Expression) (Expression, error) {
 		}
 	}
 	if t.Type != NULL {
-		return nil, fmt.Errorf("expected NULL after IS but got %q at line %d position %d", t.String(), t.Line, t.Pos)
+		return nil, p.errorf(t, []TokenType{NULL}, "expected NULL after IS but got %q", t.String())
 	}
 	return &IsNullExpr{Expr: left, Not: not}, nil
 }
@@ -275,21 +739,32 @@ func (p *Parser) parseNotPostfix(left Expression) (Expression, error) {
 		return p.parseInExpr(left, true)
 	case BETWEEN:
 		return p.parseBetweenExpr(left, true)
-	case LIKE:
+	case LIKE, ILIKE, GLOB, REGEXP:
 		right, err := p.parsePrecedence(precedenceComparison + 1)
 		if err != nil {
 			return nil, err
 		}
-		return &LikeExpr{Expr: left, Pattern: right, Not: true}, nil
+		return &LikeExpr{Op: t.Type, Expr: left, Pattern: right, Not: true}, nil
 	default:
-		return nil, fmt.Errorf("expected IN, BETWEEN, or LIKE after NOT but got %q at line %d position %d", t.String(), t.Line, t.Pos)
+		return nil, p.errorf(t, []TokenType{IN, BETWEEN, LIKE, ILIKE, GLOB, REGEXP}, "expected IN, BETWEEN, LIKE, ILIKE, GLOB, or REGEXP after NOT but got %q", t.String())
 	}
 }
 
 func (p *Parser) parseInExpr(left Expression, not bool) (Expression, error) {
-	if _, err := p.expect(LPAREN); err != nil {
+	lparen, err := p.expect(LPAREN)
+	if err != nil {
 		return nil, err
 	}
+	if t, _ := p.peek(); t.Type == SELECT || t.Type == WITH {
+		sub, err := p.parseSubquery(lparen)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(RPAREN); err != nil {
+			return nil, err
+		}
+		return &InExpr{Expr: left, Subquery: sub, Not: not}, nil
+	}
 	var values []Expression
 	for {
 		val, err := p.parseExpression()
@@ -306,7 +781,7 @@ func (p *Parser) parseInExpr(left Expression, not bool) (Expression, error) {
 			break
 		}
 		if t.Type != COMMA {
-			return nil, fmt.Errorf("expected ',' or ')' but got %q at line %d position %d", t.String(), t.Line, t.Pos)
+			return nil, p.unexpected(t, COMMA, RPAREN)
 		}
 	}
 	return &InExpr{Expr: left, Values: values, Not: not}, nil
@@ -333,9 +808,12 @@ const (
 	precedenceAND        = 2
 	precedenceNOT        = 3
 	precedenceComparison = 4
-	precedenceAddSub     = 5
-	precedenceMulDiv     = 6
-	precedenceUnary      = 7
+	precedenceBitwise    = 5
+	precedenceAddSub     = 6
+	precedenceMulDiv     = 7
+	precedenceConcat     = 8
+	precedenceUnary      = 9
+	precedenceCast       = 10
 )
 
 func infixPrecedence(t TokenType) int {
@@ -346,12 +824,18 @@ func infixPrecedence(t TokenType) int {
 		return precedenceAND
 	case NOT:
 		return precedenceComparison // for NOT IN, NOT BETWEEN, NOT LIKE
-	case EQ, NEQ, LT, LTE, GT, GTE, LIKE, IS, IN, BETWEEN:
+	case EQ, NEQ, LT, LTE, GT, GTE, LIKE, ILIKE, GLOB, REGEXP, TILDE, IS, IN, BETWEEN:
 		return precedenceComparison
+	case AMPERSAND, PIPE, LSHIFT, RSHIFT:
+		return precedenceBitwise
 	case PLUS, MINUS:
 		return precedenceAddSub
 	case STAR, SLASH, PERCENT:
 		return precedenceMulDiv
+	case CONCAT:
+		return precedenceConcat
+	case COLONCOLON:
+		return precedenceCast
 	default:
 		return -1 // not an infix operator
 	}
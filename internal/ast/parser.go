@@ -1,9 +1,9 @@
 package ast
 
 import (
-	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +12,9 @@ type Parser struct {
 	lex       *Lexer
 	scanned   []*Token
 	unscanned []*Token
+	comments  []Comment // scanned but not yet attached to a node
+	last      *Token    // last token read from the lexer other than WS or a comment
+	params    int       // highest positional parameter in the current statement
 }
 
 // NewParser returns a new Parser that reads from r.
@@ -33,16 +36,27 @@ func (p *Parser) Parse() ([]Statement, error) {
 		case SEMICOLON:
 			continue
 		case EOF:
+			if len(stmts) > 0 {
+				stmts[len(stmts)-1].Select.addComments(ClauseEnd, p.takeComments())
+			}
 			return stmts, nil
-		case SELECT:
-			p.unscan()
+		case SELECT, WITH, EXPLAIN:
+			explain := t.Type == EXPLAIN
+			if !explain {
+				p.unscan()
+			}
+			comments := p.takeComments()
+			p.params = 0
 			sel, err := p.parseSelect()
 			if err != nil {
 				return nil, err
 			}
-			stmts = append(stmts, Statement{Select: sel})
+			sel.addComments(ClauseEnd, p.commentsBefore())
+			resolvePaths(sel, nil)
+			numberParams(sel, p.params)
+			stmts = append(stmts, Statement{Select: sel, Explain: explain, Comments: comments})
 		default:
-			return nil, fmt.Errorf("unexpected token %q at line %d position %d", t.String(), t.Line, t.Pos)
+			return nil, p.errorf(t, []TokenType{SELECT, WITH, EXPLAIN}, "unexpected token %q", t.String())
 		}
 	}
 }
@@ -58,10 +72,34 @@ func (p *Parser) scan() (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	switch t.Type {
+	case COMMENT:
+		p.comments = append(p.comments, Comment{
+			Text:     t.String(),
+			Trailing: p.last != nil && p.last.Line == t.Line,
+		})
+	case WS:
+	default:
+		p.last = t
+	}
 	p.scanned = append(p.scanned, t)
 	return t, nil
 }
 
+// takeComments returns the comments scanned since the last call. Comments before
+// a token are only scanned once that token has been peeked.
+func (p *Parser) takeComments() []Comment {
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
+// commentsBefore returns the comments between the last token consumed and the next.
+func (p *Parser) commentsBefore() []Comment {
+	p.peek()
+	return p.takeComments()
+}
+
 func (p *Parser) scanSkipWS() (*Token, error) {
 	for {
 		t, err := p.scan()
@@ -98,13 +136,36 @@ func (p *Parser) peek() (*Token, error) {
 	return t, nil
 }
 
+// peekPair returns the next two non-WS tokens without consuming them.
+func (p *Parser) peekPair() (*Token, *Token, error) {
+	first, err := p.scanSkipWS()
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := p.peek()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.scanned = p.scanned[:len(p.scanned)-1]
+	p.unscanned = append(p.unscanned, first)
+	return first, second, nil
+}
+
+// peekWord reports whether the next token is an identifier spelled word, ignoring
+// case. Words that only have meaning in one clause, such as PARTITION or
+// PRECEDING, are matched this way so they stay usable as column names.
+func (p *Parser) peekWord(word string) bool {
+	t, _ := p.peek()
+	return t.Type == IDENT && strings.EqualFold(t.String(), word)
+}
+
 func (p *Parser) expect(typ TokenType) (*Token, error) {
 	t, err := p.scanSkipWS()
 	if err != nil {
 		return nil, err
 	}
 	if t.Type != typ {
-		return nil, fmt.Errorf("expected %s but got %q at line %d position %d", typ, t.String(), t.Line, t.Pos)
+		return nil, p.unexpected(t, typ)
 	}
 	return t, nil
 }
@@ -112,10 +173,172 @@ func (p *Parser) expect(typ TokenType) (*Token, error) {
 func (p *Parser) parseSelect() (*SelectStatement, error) {
 	stmt := &SelectStatement{}
 
-	if _, err := p.expect(SELECT); err != nil {
+	// WITH
+	if t, _ := p.peek(); t.Type == WITH {
+		with, err := p.parseWith()
+		if err != nil {
+			return nil, err
+		}
+		stmt.With = with
+	}
+
+	if err := p.parseSelectCore(stmt); err != nil {
 		return nil, err
 	}
 
+	// UNION / INTERSECT / EXCEPT
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+
+		var op SetOp
+		switch t.Type {
+		case UNION:
+			p.scanSkipWS()
+			op = Union
+			if t, _ := p.peek(); t.Type == ALL {
+				p.scanSkipWS()
+				op = UnionAll
+			}
+		case INTERSECT:
+			p.scanSkipWS()
+			op = Intersect
+		case EXCEPT:
+			p.scanSkipWS()
+			op = Except
+		default:
+			goto afterCompound
+		}
+		comments := p.takeComments()
+
+		member := &SelectStatement{}
+		if err := p.parseSelectCore(member); err != nil {
+			return nil, err
+		}
+		stmt.Compound = append(stmt.Compound, CompoundSelect{Op: op, Select: member, Comments: comments})
+	}
+afterCompound:
+
+	// ORDER BY
+	if t, _ := p.peek(); t.Type == ORDER {
+		stmt.addComments(ClauseOrderBy, p.takeComments())
+		p.scanSkipWS()
+		if _, err := p.expect(BY); err != nil {
+			return nil, err
+		}
+		orderBy, err := p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+		stmt.OrderBy = orderBy
+	}
+
+	// LIMIT n [OFFSET m] | LIMIT m, n
+	if t, _ := p.peek(); t.Type == LIMIT {
+		stmt.addComments(ClauseLimit, p.takeComments())
+		if err := p.parseLimit(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	// OVER duration
+	if t, _ := p.peek(); t.Type == OVER {
+		stmt.addComments(ClauseOver, p.takeComments())
+		p.scanSkipWS()
+		durTok, err := p.expect(DURATION)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(durTok.String())
+		if err != nil {
+			return nil, p.errorf(durTok, nil, "invalid duration %q", durTok.String())
+		}
+		stmt.Over = d
+	}
+
+	// EVERY duration
+	if t, _ := p.peek(); t.Type == EVERY {
+		stmt.addComments(ClauseEvery, p.takeComments())
+		p.scanSkipWS()
+		durTok, err := p.expect(DURATION)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(durTok.String())
+		if err != nil {
+			return nil, p.errorf(durTok, nil, "invalid duration %q", durTok.String())
+		}
+		stmt.Every = d
+	}
+
+	// LIMIT may also follow the streaming clauses
+	if t, _ := p.peek(); t.Type == LIMIT {
+		if stmt.Limit != nil {
+			return nil, p.errorf(t, nil, "duplicate LIMIT")
+		}
+		stmt.addComments(ClauseLimit, p.takeComments())
+		if err := p.parseLimit(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	return stmt, nil
+}
+
+// parseLimit parses "LIMIT n", "LIMIT n OFFSET m" or "LIMIT m, n" into stmt.
+func (p *Parser) parseLimit(stmt *SelectStatement) error {
+	p.scanSkipWS() // consume LIMIT
+	n, err := p.parseCount("LIMIT")
+	if err != nil {
+		return err
+	}
+
+	if t, _ := p.peek(); t.Type == COMMA {
+		p.scanSkipWS()
+		count, err := p.parseCount("LIMIT")
+		if err != nil {
+			return err
+		}
+		stmt.Limit, stmt.Offset = &count, &n
+		return nil
+	}
+
+	stmt.Limit = &n
+	if p.peekWord("OFFSET") {
+		p.scanSkipWS()
+		offset, err := p.parseCount("OFFSET")
+		if err != nil {
+			return err
+		}
+		stmt.Offset = &offset
+	}
+	return nil
+}
+
+// parseCount parses the non-negative integer argument of a LIMIT or OFFSET clause.
+func (p *Parser) parseCount(clause string) (int, error) {
+	numTok, err := p.expect(NUMERIC)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(numTok.String())
+	if err != nil || n < 0 {
+		return 0, p.errorf(numTok, []TokenType{NUMERIC}, "invalid %s value %q", clause, numTok.String())
+	}
+	return n, nil
+}
+
+// parseSelectCore parses a single "SELECT ... [HAVING ...]" into stmt: everything
+// except the WITH, ORDER BY, LIMIT and streaming clauses, which belong to the whole
+// compound statement.
+func (p *Parser) parseSelectCore(stmt *SelectStatement) error {
+	stmt.addComments(ClauseSelect, p.commentsBefore())
+	if _, err := p.expect(SELECT); err != nil {
+		return err
+	}
+
 	// DISTINCT
 	if t, _ := p.peek(); t.Type == DISTINCT {
 		p.scanSkipWS()
@@ -125,19 +348,20 @@ func (p *Parser) parseSelect() (*SelectStatement, error) {
 	// columns
 	cols, err := p.parseColumns()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	stmt.Columns = cols
 
 	// FROM
 	if t, _ := p.peek(); t.Type != FROM {
-		return stmt, nil
+		return nil
 	}
+	stmt.addComments(ClauseFrom, p.takeComments())
 	p.scanSkipWS() // consume FROM
 
 	from, err := p.parseTableRef()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	stmt.From = &FromClause{Table: *from}
 
@@ -145,128 +369,156 @@ func (p *Parser) parseSelect() (*SelectStatement, error) {
 	for {
 		t, err := p.peek()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		var joinType JoinType
 		switch t.Type {
-		case JOIN:
+		case COMMA:
 			p.scanSkipWS()
-			joinType = InnerJoin
-		case LEFT:
+			joinType = CommaJoin
+		case JOIN, INNER, LEFT, RIGHT, FULL, CROSS:
 			p.scanSkipWS()
-			joinType = LeftJoin
-			if _, err := p.expect(JOIN); err != nil {
-				return nil, err
-			}
-		case RIGHT:
-			p.scanSkipWS()
-			joinType = RightJoin
-			if _, err := p.expect(JOIN); err != nil {
-				return nil, err
+			if joinType, err = p.parseJoinType(t); err != nil {
+				return err
 			}
 		default:
 			goto afterJoins
 		}
+		// Comments on either side of the comma or join keywords belong to the join.
+		comments := p.commentsBefore()
 
 		jt, err := p.parseTableRef()
 		if err != nil {
-			return nil, err
-		}
-		if _, err := p.expect(ON); err != nil {
-			return nil, err
+			return err
 		}
-		cond, err := p.parseExpression()
-		if err != nil {
-			return nil, err
+		join := JoinClause{Type: joinType, Table: *jt, Comments: comments}
+		if joinType != CrossJoin && joinType != CommaJoin {
+			if err := p.parseJoinConstraint(&join); err != nil {
+				return err
+			}
 		}
-		stmt.Joins = append(stmt.Joins, JoinClause{
-			Type:      joinType,
-			Table:     *jt,
-			Condition: cond,
-		})
+		stmt.Joins = append(stmt.Joins, join)
 	}
 afterJoins:
 
 	// WHERE
 	if t, _ := p.peek(); t.Type == WHERE {
+		stmt.addComments(ClauseWhere, p.takeComments())
 		p.scanSkipWS()
 		where, err := p.parseExpression()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		stmt.Where = where
 	}
 
 	// GROUP BY
 	if t, _ := p.peek(); t.Type == GROUP {
+		stmt.addComments(ClauseGroupBy, p.takeComments())
 		p.scanSkipWS()
 		if _, err := p.expect(BY); err != nil {
-			return nil, err
+			return err
 		}
 		exprs, err := p.parseExpressionList()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		stmt.GroupBy = exprs
 	}
 
-	// ORDER BY
-	if t, _ := p.peek(); t.Type == ORDER {
+	// HAVING
+	if t, _ := p.peek(); t.Type == HAVING {
+		stmt.addComments(ClauseHaving, p.takeComments())
 		p.scanSkipWS()
-		if _, err := p.expect(BY); err != nil {
-			return nil, err
-		}
-		orderBy, err := p.parseOrderBy()
+		having, err := p.parseExpression()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		stmt.OrderBy = orderBy
+		stmt.Having = having
 	}
 
-	// OVER duration
-	if t, _ := p.peek(); t.Type == OVER {
-		p.scanSkipWS()
-		durTok, err := p.expect(DURATION)
-		if err != nil {
-			return nil, err
-		}
-		d, err := time.ParseDuration(durTok.String())
-		if err != nil {
-			return nil, fmt.Errorf("invalid duration %q at line %d position %d", durTok.String(), durTok.Line, durTok.Pos)
+	return nil
+}
+
+// parseJoinType parses the rest of a join operator whose first token t has been
+// consumed: JOIN, INNER JOIN, LEFT|RIGHT|FULL [OUTER] JOIN or CROSS JOIN.
+func (p *Parser) parseJoinType(t *Token) (JoinType, error) {
+	var joinType JoinType
+	switch t.Type {
+	case JOIN:
+		return InnerJoin, nil
+	case INNER:
+		joinType = InnerJoin
+	case CROSS:
+		joinType = CrossJoin
+	case LEFT:
+		joinType = LeftJoin
+	case RIGHT:
+		joinType = RightJoin
+	case FULL:
+		joinType = FullJoin
+	}
+	if joinType == LeftJoin || joinType == RightJoin || joinType == FullJoin {
+		if next, _ := p.peek(); next.Type == OUTER {
+			p.scanSkipWS()
 		}
-		stmt.Over = d
 	}
+	if _, err := p.expect(JOIN); err != nil {
+		return 0, err
+	}
+	return joinType, nil
+}
 
-	// EVERY duration
-	if t, _ := p.peek(); t.Type == EVERY {
-		p.scanSkipWS()
-		durTok, err := p.expect(DURATION)
+// parseJoinConstraint parses "ON condition" or "USING (col, ...)" into join.
+func (p *Parser) parseJoinConstraint(join *JoinClause) error {
+	t, err := p.scanSkipWS()
+	if err != nil {
+		return err
+	}
+	switch t.Type {
+	case ON:
+		cond, err := p.parseExpression()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		d, err := time.ParseDuration(durTok.String())
+		join.Condition = cond
+	case USING:
+		if _, err := p.expect(LPAREN); err != nil {
+			return err
+		}
+		cols, err := p.parseIdentList()
 		if err != nil {
-			return nil, fmt.Errorf("invalid duration %q at line %d position %d", durTok.String(), durTok.Line, durTok.Pos)
+			return err
 		}
-		stmt.Every = d
+		join.Using = cols
+	default:
+		return p.unexpected(t, ON, USING)
 	}
+	return nil
+}
 
-	// LIMIT n
-	if t, _ := p.peek(); t.Type == LIMIT {
-		p.scanSkipWS()
-		numTok, err := p.expect(NUMERIC)
+// parseIdentList parses "name, name, ...)" after the opening paren has been consumed.
+func (p *Parser) parseIdentList() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.expect(IDENT)
 		if err != nil {
 			return nil, err
 		}
-		n, err := strconv.Atoi(numTok.String())
+		names = append(names, identName(name))
+
+		t, err := p.scanSkipWS()
 		if err != nil {
-			return nil, fmt.Errorf("invalid LIMIT value %q at line %d position %d", numTok.String(), numTok.Line, numTok.Pos)
+			return nil, err
+		}
+		if t.Type == RPAREN {
+			return names, nil
+		}
+		if t.Type != COMMA {
+			return nil, p.unexpected(t, COMMA, RPAREN)
 		}
-		stmt.Limit = &n
 	}
-
-	return stmt, nil
 }
 
 func (p *Parser) parseColumns() ([]Column, error) {
@@ -292,11 +544,13 @@ func (p *Parser) parseColumn() (*Column, error) {
 	if err != nil {
 		return nil, err
 	}
+	comments := p.takeComments()
+	pos := Position{Line: t.Line, Pos: t.Pos}
 
 	// Check for bare *
 	if t.Type == STAR {
 		p.scanSkipWS() // consume the star
-		return &Column{Star: true}, nil
+		return &Column{Star: true, Comments: comments, Position: pos}, nil
 	}
 
 	// Parse as expression (handles ident, ident.col, functions, etc.)
@@ -307,10 +561,10 @@ func (p *Parser) parseColumn() (*Column, error) {
 
 	// Check if the expression is "table.*" via the ColumnRef with Column="*"
 	if ref, ok := expr.(*ColumnRef); ok && ref.Column == "*" {
-		return &Column{Star: true, TableRef: ref.Table}, nil
+		return &Column{Star: true, TableRef: ref.Table, Comments: comments, Position: pos}, nil
 	}
 
-	col := &Column{Expr: expr}
+	col := &Column{Expr: expr, Comments: comments, Position: pos}
 
 	// Optional AS alias
 	t, err = p.peek()
@@ -323,23 +577,35 @@ func (p *Parser) parseColumn() (*Column, error) {
 		if err != nil {
 			return nil, err
 		}
-		col.Alias = alias.String()
+		col.Alias = identName(alias)
 	} else if t.Type == IDENT {
 		// implicit alias (no AS keyword) — but only if it's not a keyword
 		p.scanSkipWS()
-		col.Alias = t.String()
+		col.Alias = identName(t)
 	}
 
 	return col, nil
 }
 
 func (p *Parser) parseTableRef() (*TableRef, error) {
+	if t, _ := p.peek(); t.Type == LPAREN {
+		return p.parseDerivedTable()
+	}
+
 	name, err := p.expect(IDENT)
 	if err != nil {
 		return nil, err
 	}
 
-	ref := &TableRef{Name: name.String()}
+	ref := &TableRef{}
+	switch parts := splitIdent(name.String()); len(parts) {
+	case 1:
+		ref.Name = parts[0]
+	case 2:
+		ref.Schema, ref.Name = parts[0], parts[1]
+	default:
+		return nil, p.errorf(name, nil, "expected table or schema.table but got %q", name.String())
+	}
 
 	// Optional alias
 	t, err := p.peek()
@@ -352,16 +618,115 @@ func (p *Parser) parseTableRef() (*TableRef, error) {
 		if err != nil {
 			return nil, err
 		}
-		ref.Alias = alias.String()
+		ref.Alias = identName(alias)
 	} else if t.Type == IDENT {
 		p.scanSkipWS() // consume the alias
-		ref.Alias = t.String()
+		ref.Alias = identName(t)
 	}
 	// Otherwise, no alias — token stays for the next clause
 
 	return ref, nil
 }
 
+// parseWith parses "WITH [RECURSIVE] name [(columns)] AS (SELECT ...), ...".
+func (p *Parser) parseWith() (*WithClause, error) {
+	if _, err := p.expect(WITH); err != nil {
+		return nil, err
+	}
+
+	with := &WithClause{}
+	if t, _ := p.peek(); t.Type == RECURSIVE {
+		p.scanSkipWS()
+		with.Recursive = true
+	}
+
+	for {
+		comments := p.commentsBefore()
+		name, err := p.expect(IDENT)
+		if err != nil {
+			return nil, err
+		}
+		cte := CTE{Name: identName(name), Comments: comments}
+
+		if t, _ := p.peek(); t.Type == LPAREN {
+			p.scanSkipWS()
+			cols, err := p.parseIdentList()
+			if err != nil {
+				return nil, err
+			}
+			cte.Columns = cols
+		}
+
+		if _, err := p.expect(AS); err != nil {
+			return nil, err
+		}
+		lparen, err := p.expect(LPAREN)
+		if err != nil {
+			return nil, err
+		}
+		sel, err := p.parseSubquery(lparen)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(RPAREN); err != nil {
+			return nil, err
+		}
+		cte.Select = sel
+		with.CTEs = append(with.CTEs, cte)
+
+		if t, _ := p.peek(); t.Type != COMMA {
+			return with, nil
+		}
+		p.scanSkipWS() // consume comma
+	}
+}
+
+// parseDerivedTable parses "(SELECT ...) [AS] alias" in a FROM or JOIN clause.
+func (p *Parser) parseDerivedTable() (*TableRef, error) {
+	lparen, err := p.expect(LPAREN)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := p.parseSubquery(lparen)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(RPAREN); err != nil {
+		return nil, err
+	}
+
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.Type == AS {
+		p.scanSkipWS() // consume AS
+	}
+	alias, err := p.scanSkipWS()
+	if err != nil {
+		return nil, err
+	}
+	if alias.Type != IDENT {
+		return nil, p.errorf(alias, []TokenType{IDENT}, "derived table requires an alias but got %q", alias.String())
+	}
+
+	return &TableRef{Alias: identName(alias), Subquery: sub}, nil
+}
+
+// parseSubquery parses a nested SELECT. Streaming clauses only make sense on the
+// outermost statement, so OVER and EVERY are rejected here.
+func (p *Parser) parseSubquery(open *Token) (*SelectStatement, error) {
+	sub, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	sub.addComments(ClauseEnd, p.commentsBefore())
+	if sub.Over > 0 || sub.Every > 0 {
+		return nil, p.errorf(open, nil, "OVER and EVERY are only allowed on the outermost SELECT")
+	}
+	return sub, nil
+}
+
 func (p *Parser) parseOrderBy() ([]OrderByExpr, error) {
 	var orders []OrderByExpr
 
@@ -1,8 +1,11 @@
 package ast
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseBasicSelect(t *testing.T) {
@@ -66,6 +69,219 @@ func TestParseBasicSelect(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:  "select with having",
+			input: "SELECT status, COUNT(*) FROM stdin GROUP BY status HAVING COUNT(*) > 100 ORDER BY status",
+			check: func(t *testing.T, sel *SelectStatement) {
+				bin, ok := sel.Having.(*BinaryExpr)
+				if !ok || bin.Op != GT {
+					t.Fatalf("expected HAVING comparison, got %+v", sel.Having)
+				}
+				if fn, ok := bin.Left.(*FunctionExpr); !ok || fn.Name != "COUNT" {
+					t.Errorf("expected COUNT on left of HAVING, got %+v", bin.Left)
+				}
+				if len(sel.OrderBy) != 1 {
+					t.Errorf("expected ORDER BY after HAVING, got %+v", sel.OrderBy)
+				}
+			},
+		},
+		{
+			name:  "searched case",
+			input: "SELECT CASE WHEN latency > 500 THEN 'slow' WHEN latency > 100 THEN 'ok' ELSE 'fast' END AS bucket FROM stdin",
+			check: func(t *testing.T, sel *SelectStatement) {
+				c, ok := sel.Columns[0].Expr.(*CaseExpr)
+				if !ok {
+					t.Fatalf("expected CaseExpr, got %+v", sel.Columns[0].Expr)
+				}
+				if c.Operand != nil {
+					t.Errorf("searched CASE should have no operand, got %+v", c.Operand)
+				}
+				if len(c.Whens) != 2 || c.Else == nil {
+					t.Errorf("expected 2 WHENs and an ELSE, got %+v", c)
+				}
+				if sel.Columns[0].Alias != "bucket" {
+					t.Errorf("expected alias 'bucket', got %q", sel.Columns[0].Alias)
+				}
+			},
+		},
+		{
+			name:  "simple case",
+			input: "SELECT CASE status WHEN 200 THEN 'ok' WHEN 500 THEN 'error' END FROM stdin",
+			check: func(t *testing.T, sel *SelectStatement) {
+				c, ok := sel.Columns[0].Expr.(*CaseExpr)
+				if !ok {
+					t.Fatalf("expected CaseExpr, got %+v", sel.Columns[0].Expr)
+				}
+				if ref, ok := c.Operand.(*ColumnRef); !ok || ref.Column != "status" {
+					t.Errorf("expected operand 'status', got %+v", c.Operand)
+				}
+				if len(c.Whens) != 2 || c.Else != nil {
+					t.Errorf("expected 2 WHENs and no ELSE, got %+v", c)
+				}
+			},
+		},
+		{
+			name:  "cast and shorthand",
+			input: "SELECT CAST(zip AS text), -n::integer, ok::Boolean FROM stdin",
+			check: func(t *testing.T, sel *SelectStatement) {
+				c, ok := sel.Columns[0].Expr.(*CastExpr)
+				if !ok || c.Type != "TEXT" {
+					t.Fatalf("expected CAST to TEXT, got %+v", sel.Columns[0].Expr)
+				}
+				// :: binds tighter than unary minus
+				u, ok := sel.Columns[1].Expr.(*UnaryExpr)
+				if !ok {
+					t.Fatalf("expected unary minus, got %+v", sel.Columns[1].Expr)
+				}
+				if c, ok := u.Operand.(*CastExpr); !ok || c.Type != "INTEGER" {
+					t.Errorf("expected cast operand, got %+v", u.Operand)
+				}
+				if c, ok := sel.Columns[2].Expr.(*CastExpr); !ok || c.Type != "BOOLEAN" {
+					t.Errorf("expected BOOLEAN cast, got %+v", sel.Columns[2].Expr)
+				}
+			},
+		},
+		{
+			name:  "derived tables in from and join",
+			input: "SELECT s.status, l.label FROM (SELECT status, COUNT(*) cnt FROM stdin GROUP BY status) AS s JOIN (SELECT code, label FROM lookup) l ON s.status = l.code",
+			check: func(t *testing.T, sel *SelectStatement) {
+				from := sel.From.Table
+				if from.Subquery == nil || from.Alias != "s" || from.Name != "" {
+					t.Fatalf("expected derived table aliased s, got %+v", from)
+				}
+				if from.Subquery.From.Table.Name != "stdin" || len(from.Subquery.GroupBy) != 1 {
+					t.Errorf("unexpected subquery: %+v", from.Subquery)
+				}
+				if len(sel.Joins) != 1 || sel.Joins[0].Table.Subquery == nil || sel.Joins[0].Table.Alias != "l" {
+					t.Errorf("expected derived table in JOIN aliased l, got %+v", sel.Joins)
+				}
+			},
+		},
+		{
+			name:  "expression subqueries",
+			input: "SELECT id, (SELECT MAX(age) FROM users) oldest FROM stdin WHERE user_id IN (SELECT id FROM blocked) AND NOT EXISTS (SELECT 1 FROM admins a WHERE a.id = stdin.user_id)",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if sub, ok := sel.Columns[1].Expr.(*SubqueryExpr); !ok || sub.Select.From.Table.Name != "users" {
+					t.Errorf("expected scalar subquery over users, got %+v", sel.Columns[1].Expr)
+				}
+				and, ok := sel.Where.(*BinaryExpr)
+				if !ok || and.Op != AND {
+					t.Fatalf("expected AND, got %+v", sel.Where)
+				}
+				in, ok := and.Left.(*InExpr)
+				if !ok || in.Subquery == nil || in.Values != nil || in.Subquery.From.Table.Name != "blocked" {
+					t.Errorf("expected IN subquery over blocked, got %+v", and.Left)
+				}
+				not, ok := and.Right.(*UnaryExpr)
+				if !ok || not.Op != NOT {
+					t.Fatalf("expected NOT, got %+v", and.Right)
+				}
+				if ex, ok := not.Operand.(*ExistsExpr); !ok || ex.Subquery.From.Table.Name != "admins" {
+					t.Errorf("expected EXISTS over admins, got %+v", not.Operand)
+				}
+				if n := len(sel.Subqueries()); n != 3 {
+					t.Errorf("expected 3 subqueries, got %d", n)
+				}
+			},
+		},
+		{
+			name:  "with clause",
+			input: "WITH RECURSIVE big(id, n) AS (SELECT id, qty FROM orders WHERE qty > 2), names AS (SELECT name FROM users) SELECT * FROM big JOIN names ON big.id = names.id",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if sel.With == nil || !sel.With.Recursive {
+					t.Fatalf("expected WITH RECURSIVE, got %+v", sel.With)
+				}
+				if len(sel.With.CTEs) != 2 {
+					t.Fatalf("expected 2 CTEs, got %d", len(sel.With.CTEs))
+				}
+				big := sel.With.CTEs[0]
+				if big.Name != "big" || len(big.Columns) != 2 || big.Columns[1] != "n" {
+					t.Errorf("unexpected first CTE: %+v", big)
+				}
+				if big.Select.From.Table.Name != "orders" {
+					t.Errorf("unexpected first CTE body: %+v", big.Select)
+				}
+				if sel.With.CTEs[1].Name != "names" || sel.With.CTEs[1].Columns != nil {
+					t.Errorf("unexpected second CTE: %+v", sel.With.CTEs[1])
+				}
+				if sel.From.Table.Name != "big" {
+					t.Errorf("expected FROM big, got %+v", sel.From)
+				}
+			},
+		},
+		{
+			name:  "compound select",
+			input: "SELECT action FROM a UNION ALL SELECT action FROM b WHERE x > 1 UNION SELECT action FROM c EXCEPT SELECT action FROM d INTERSECT SELECT action FROM e ORDER BY action OVER 1m LIMIT 5",
+			check: func(t *testing.T, sel *SelectStatement) {
+				wantOps := []SetOp{UnionAll, Union, Except, Intersect}
+				if len(sel.Compound) != len(wantOps) {
+					t.Fatalf("expected %d compound members, got %d", len(wantOps), len(sel.Compound))
+				}
+				for i, op := range wantOps {
+					if sel.Compound[i].Op != op {
+						t.Errorf("member %d: expected op %v, got %v", i, op, sel.Compound[i].Op)
+					}
+				}
+				if sel.Compound[0].Select.From.Table.Name != "b" || sel.Compound[0].Select.Where == nil {
+					t.Errorf("unexpected first member: %+v", sel.Compound[0].Select)
+				}
+				// ORDER BY, LIMIT and OVER belong to the whole compound
+				last := sel.Compound[3].Select
+				if last.OrderBy != nil || last.Limit != nil || last.Over != 0 {
+					t.Errorf("last member should not own trailing clauses: %+v", last)
+				}
+				if len(sel.OrderBy) != 1 || sel.Limit == nil || *sel.Limit != 5 || sel.Over.String() != "1m0s" {
+					t.Errorf("expected trailing ORDER BY/LIMIT/OVER on head, got %+v", sel)
+				}
+			},
+		},
+		{
+			name:  "analytic window functions",
+			input: "SELECT ROW_NUMBER() OVER (PARTITION BY user, region ORDER BY ts DESC) AS rn, SUM(amount) OVER (ORDER BY ts ROWS BETWEEN 2 PRECEDING AND CURRENT ROW), COUNT(*) OVER () FROM stdin OVER 5m",
+			check: func(t *testing.T, sel *SelectStatement) {
+				rn, ok := sel.Columns[0].Expr.(*FunctionExpr)
+				if !ok || rn.Name != "ROW_NUMBER" || rn.Over == nil {
+					t.Fatalf("expected ROW_NUMBER window call, got %+v", sel.Columns[0].Expr)
+				}
+				if len(rn.Over.PartitionBy) != 2 || len(rn.Over.OrderBy) != 1 || !rn.Over.OrderBy[0].Desc || rn.Over.Frame != nil {
+					t.Errorf("unexpected ROW_NUMBER window spec: %+v", rn.Over)
+				}
+				if sel.Columns[0].Alias != "rn" {
+					t.Errorf("expected alias rn, got %q", sel.Columns[0].Alias)
+				}
+
+				sum := sel.Columns[1].Expr.(*FunctionExpr)
+				frame := sum.Over.Frame
+				if frame == nil || frame.Unit != "ROWS" || frame.Start.Kind != Preceding || frame.End == nil || frame.End.Kind != CurrentRow {
+					t.Fatalf("unexpected SUM frame: %+v", frame)
+				}
+				if lit, ok := frame.Start.Offset.(*LiteralExpr); !ok || lit.Value != "2" {
+					t.Errorf("expected offset 2, got %+v", frame.Start.Offset)
+				}
+
+				count := sel.Columns[2].Expr.(*FunctionExpr)
+				if count.Over == nil || count.Over.PartitionBy != nil || count.Over.OrderBy != nil {
+					t.Errorf("expected empty window spec, got %+v", count.Over)
+				}
+
+				// The trailing OVER is still the tumbling window
+				if sel.Over.String() != "5m0s" {
+					t.Errorf("expected OVER 5m, got %v", sel.Over)
+				}
+			},
+		},
+		{
+			name:  "aggregate before statement-level over",
+			input: "SELECT COUNT(*) FROM stdin GROUP BY status ORDER BY COUNT(*) OVER 1m",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if fn := sel.OrderBy[0].Expr.(*FunctionExpr); fn.Over != nil {
+					t.Errorf("expected plain COUNT(*), got window spec %+v", fn.Over)
+				}
+				if sel.Over.String() != "1m0s" {
+					t.Errorf("expected OVER 1m, got %v", sel.Over)
+				}
+			},
+		},
 		{
 			name:  "select with over and every",
 			input: "SELECT status, COUNT(*) FROM stdin GROUP BY status OVER 5m EVERY 10s",
@@ -78,6 +294,153 @@ func TestParseBasicSelect(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:  "operator precedence",
+			input: "SELECT host || ':' || port = 'a:1', flags & 4 + 1, ~mask FROM stdin",
+			check: func(t *testing.T, sel *SelectStatement) {
+				// (host || ':' || port) = 'a:1'
+				eq, ok := sel.Columns[0].Expr.(*BinaryExpr)
+				if !ok || eq.Op != EQ {
+					t.Fatalf("expected = at top, got %+v", sel.Columns[0].Expr)
+				}
+				concat, ok := eq.Left.(*BinaryExpr)
+				if !ok || concat.Op != CONCAT {
+					t.Fatalf("expected || under =, got %+v", eq.Left)
+				}
+				if inner, ok := concat.Left.(*BinaryExpr); !ok || inner.Op != CONCAT {
+					t.Errorf("expected left-associative ||, got %+v", concat.Left)
+				}
+
+				// flags & (4 + 1)
+				and, ok := sel.Columns[1].Expr.(*BinaryExpr)
+				if !ok || and.Op != AMPERSAND {
+					t.Fatalf("expected & at top, got %+v", sel.Columns[1].Expr)
+				}
+				if add, ok := and.Right.(*BinaryExpr); !ok || add.Op != PLUS {
+					t.Errorf("expected + under &, got %+v", and.Right)
+				}
+
+				if not, ok := sel.Columns[2].Expr.(*UnaryExpr); !ok || not.Op != TILDE {
+					t.Errorf("expected unary ~, got %+v", sel.Columns[2].Expr)
+				}
+			},
+		},
+		{
+			name:  "json paths",
+			input: "SELECT payload.user.id, payload['user']['first name'], tags[0].label, e.payload.count, e.id FROM stdin e JOIN users u ON e.payload.uid = u.id WHERE u.meta.active GROUP BY payload.user.id",
+			check: func(t *testing.T, sel *SelectStatement) {
+				wantPath := func(expr Expression, table, column string, steps ...PathStep) {
+					t.Helper()
+					path, ok := expr.(*PathExpr)
+					if !ok {
+						t.Fatalf("expected PathExpr, got %+v", expr)
+					}
+					if path.Column.Table != table || path.Column.Column != column {
+						t.Errorf("expected column %s.%s, got %+v", table, column, path.Column)
+					}
+					if fmt.Sprint(path.Path) != fmt.Sprint(steps) {
+						t.Errorf("expected path %v, got %v", steps, path.Path)
+					}
+				}
+				key := func(k string) PathStep { return PathStep{Key: k} }
+
+				// payload is not a table in scope, so it is the JSON column
+				wantPath(sel.Columns[0].Expr, "", "payload", key("user"), key("id"))
+				wantPath(sel.Columns[1].Expr, "", "payload", key("user"), key("first name"))
+				wantPath(sel.Columns[2].Expr, "", "tags", PathStep{Index: 0, IsIndex: true}, key("label"))
+				// e is an alias, so e.payload is a qualified column
+				wantPath(sel.Columns[3].Expr, "e", "payload", key("count"))
+				if ref, ok := sel.Columns[4].Expr.(*ColumnRef); !ok || ref.Table != "e" || ref.Column != "id" {
+					t.Errorf("expected column e.id, got %+v", sel.Columns[4].Expr)
+				}
+
+				cond := sel.Joins[0].Condition.(*BinaryExpr)
+				wantPath(cond.Left, "e", "payload", key("uid"))
+				wantPath(sel.Where, "u", "meta", key("active"))
+				wantPath(sel.GroupBy[0], "", "payload", key("user"), key("id"))
+			},
+		},
+		{
+			name:  "qualified name resolved in correlated subquery",
+			input: "SELECT id FROM users u WHERE EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.meta.vip)",
+			check: func(t *testing.T, sel *SelectStatement) {
+				sub := sel.Where.(*ExistsExpr).Subquery
+				and := sub.Where.(*BinaryExpr)
+				eq := and.Left.(*BinaryExpr)
+				if ref, ok := eq.Right.(*ColumnRef); !ok || ref.Table != "u" {
+					t.Errorf("expected outer column u.id, got %+v", eq.Right)
+				}
+				if path, ok := and.Right.(*PathExpr); !ok || path.Column.Table != "o" || path.Column.Column != "meta" {
+					t.Errorf("expected path on o.meta, got %+v", and.Right)
+				}
+			},
+		},
+		{
+			name:  "qualifier matches table in any case",
+			input: "SELECT U.name, Users.meta.vip FROM users u, USERS",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if ref, ok := sel.Columns[0].Expr.(*ColumnRef); !ok || ref.Table != "U" || ref.Column != "name" {
+					t.Errorf("expected column U.name, got %+v", sel.Columns[0].Expr)
+				}
+				if path, ok := sel.Columns[1].Expr.(*PathExpr); !ok || path.Column.Table != "Users" || path.Column.Column != "meta" {
+					t.Errorf("expected path on Users.meta, got %+v", sel.Columns[1].Expr)
+				}
+			},
+		},
+		{
+			name:  "join forms",
+			input: "SELECT * FROM a LEFT OUTER JOIN b USING (id, day) RIGHT OUTER JOIN c ON b.x = c.x FULL JOIN d USING (x) CROSS JOIN e, f INNER JOIN g ON g.y = f.y",
+			check: func(t *testing.T, sel *SelectStatement) {
+				want := []JoinType{LeftJoin, RightJoin, FullJoin, CrossJoin, CommaJoin, InnerJoin}
+				if len(sel.Joins) != len(want) {
+					t.Fatalf("expected %d joins, got %d", len(want), len(sel.Joins))
+				}
+				for i, typ := range want {
+					if sel.Joins[i].Type != typ {
+						t.Errorf("join %d: expected type %v, got %v", i, typ, sel.Joins[i].Type)
+					}
+				}
+				if fmt.Sprint(sel.Joins[0].Using) != "[id day]" || sel.Joins[0].Condition != nil {
+					t.Errorf("expected USING (id, day), got %+v", sel.Joins[0])
+				}
+				if sel.Joins[1].Condition == nil || sel.Joins[1].Using != nil {
+					t.Errorf("expected ON condition, got %+v", sel.Joins[1])
+				}
+				if sel.Joins[3].Condition != nil || sel.Joins[4].Condition != nil || sel.Joins[4].Table.Name != "f" {
+					t.Errorf("expected unconditioned cross and comma joins, got %+v", sel.Joins[3:5])
+				}
+			},
+		},
+		{
+			name:  "limit with offset",
+			input: "SELECT * FROM stdin ORDER BY id LIMIT 10 OFFSET 20",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if sel.Limit == nil || *sel.Limit != 10 || sel.Offset == nil || *sel.Offset != 20 {
+					t.Errorf("expected LIMIT 10 OFFSET 20, got %v %v", sel.Limit, sel.Offset)
+				}
+			},
+		},
+		{
+			name:  "limit offset comma form",
+			input: "SELECT * FROM stdin LIMIT 20, 10",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if sel.Limit == nil || *sel.Limit != 10 || sel.Offset == nil || *sel.Offset != 20 {
+					t.Errorf("expected LIMIT 10 OFFSET 20, got %v %v", sel.Limit, sel.Offset)
+				}
+			},
+		},
+		{
+			name:  "limit before over and every",
+			input: "SELECT status, COUNT(*) FROM stdin GROUP BY status ORDER BY 2 DESC LIMIT 3 OVER 5m EVERY 10s",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if sel.Limit == nil || *sel.Limit != 3 || sel.Offset != nil {
+					t.Errorf("expected LIMIT 3, got %v %v", sel.Limit, sel.Offset)
+				}
+				if sel.Over.String() != "5m0s" || sel.Every.String() != "10s" {
+					t.Errorf("expected OVER 5m EVERY 10s, got %v %v", sel.Over, sel.Every)
+				}
+			},
+		},
 		{
 			name:  "count star with alias",
 			input: "SELECT COUNT(*) AS cnt FROM stdin",
@@ -90,6 +453,27 @@ func TestParseBasicSelect(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:  "quoted and schema-qualified tables",
+			input: "SELECT `my t`.[a.b], \"it\"\"s\" FROM app.[order items] AS `my t` JOIN \"x y\" USING ([user id])",
+			check: func(t *testing.T, sel *SelectStatement) {
+				if ref := sel.From.Table; ref.Schema != "app" || ref.Name != "order items" || ref.Alias != "my t" {
+					t.Errorf("expected app.\"order items\" aliased \"my t\", got %+v", ref)
+				}
+				if ref := sel.Joins[0].Table; ref.Schema != "" || ref.Name != "x y" {
+					t.Errorf("expected table \"x y\", got %+v", ref)
+				}
+				if using := sel.Joins[0].Using; len(using) != 1 || using[0] != "user id" {
+					t.Errorf("expected USING (\"user id\"), got %q", using)
+				}
+				if ref, ok := sel.Columns[0].Expr.(*ColumnRef); !ok || ref.Table != "my t" || ref.Column != "a.b" {
+					t.Errorf("expected column \"my t\".\"a.b\", got %+v", sel.Columns[0].Expr)
+				}
+				if ref, ok := sel.Columns[1].Expr.(*ColumnRef); !ok || ref.Column != `it"s` {
+					t.Errorf("expected column it\"s, got %+v", sel.Columns[1].Expr)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -106,3 +490,496 @@ func TestParseBasicSelect(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"SELECT CASE END FROM stdin",
+		"SELECT CASE WHEN a THEN b FROM stdin",
+		"SELECT CASE ELSE 1 END FROM stdin",
+		"SELECT CAST(x AS VARCHAR) FROM stdin",
+		"SELECT x::blob FROM stdin",
+		"SELECT CAST(x) FROM stdin",
+		"SELECT * FROM (SELECT * FROM stdin)",
+		"SELECT * FROM (SELECT * FROM stdin OVER 5m) t",
+		"SELECT * FROM stdin WHERE id IN (SELECT id FROM t",
+		"SELECT * FROM stdin WHERE EXISTS id",
+		"WITH t AS SELECT 1 SELECT * FROM t",
+		"WITH t AS (SELECT 1)",
+		"WITH t AS (SELECT * FROM stdin OVER 1m) SELECT * FROM t",
+		"SELECT a FROM t UNION",
+		"SELECT a FROM t ORDER BY a UNION SELECT a FROM u",
+		"SELECT a FROM t UNION ALL WITH x AS (SELECT 1) SELECT a FROM x",
+		"SELECT ROW_NUMBER() OVER (ORDER BY ts FROM stdin",
+		"SELECT SUM(x) OVER (ROWS BETWEEN UNBOUNDED AND CURRENT ROW) FROM stdin",
+		"SELECT SUM(x) OVER (ROWS CURRENT) FROM stdin",
+		"SELECT SUM(x) OVER (PARTITION user) FROM stdin",
+		"SELECT * FROM stdin LIMIT 5 OVER 1m LIMIT 5",
+		"SELECT * FROM stdin LIMIT 5 OFFSET",
+		"SELECT * FROM stdin LIMIT 5,",
+		"SELECT * FROM stdin LIMIT -1",
+		"SELECT * FROM stdin OFFSET 5",
+		"SELECT a || FROM stdin",
+		"SELECT a << FROM stdin",
+		"SELECT tags[ FROM stdin",
+		"SELECT tags[x] FROM stdin",
+		"SELECT tags[-1] FROM stdin",
+		"SELECT tags[0 FROM stdin",
+		"SELECT tags[0]., x FROM stdin",
+		"SELECT * FROM a JOIN b",
+		"SELECT * FROM a LEFT OUTER b ON a.x = b.x",
+		"SELECT * FROM a OUTER JOIN b ON a.x = b.x",
+		"SELECT * FROM a INNER b ON a.x = b.x",
+		"SELECT * FROM a JOIN b USING ()",
+		"SELECT * FROM a JOIN b USING id",
+		"SELECT * FROM a CROSS JOIN b ON a.x = b.x",
+		"SELECT * FROM a,",
+		"SELECT * FROM a.b.c",
+		"SELECT * FROM [a",
+	}
+	for _, input := range tests {
+		p := NewParser(strings.NewReader(input))
+		if _, err := p.Parse(); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	schemas := map[string][]string{
+		"users":  {"id", "name", "age", "profile"},
+		"orders": {"id", "user_id", "total"},
+	}
+	valid := []string{
+		"SELECT u.name, o.total FROM users u JOIN orders o ON u.id = o.user_id",
+		"SELECT name, COUNT(*) AS n FROM users GROUP BY name ORDER BY n DESC",
+		"SELECT age / 10 AS decade, COUNT(*) FROM users GROUP BY decade",
+		"SELECT age / 10, COUNT(*) FROM users GROUP BY 1",
+		"SELECT age / 10, COUNT(*) FROM users GROUP BY age / 10",
+		"SELECT u.name, SUM(o.total) FROM users u JOIN orders o ON u.id = o.user_id GROUP BY u.name HAVING SUM(o.total) > 10",
+		"SELECT name, ROW_NUMBER() OVER (ORDER BY age) FROM users",
+		"SELECT profile.city, COUNT(*) FROM users GROUP BY profile.city",
+		"SELECT name FROM users u WHERE EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id)",
+		"SELECT name, (SELECT MAX(total) FROM orders WHERE user_id = users.id) FROM users",
+		"WITH big AS (SELECT user_id, total AS amount FROM orders) SELECT b.amount FROM big b",
+		"SELECT t.n FROM (SELECT name AS n FROM users) t",
+		"SELECT x.anything FROM (SELECT * FROM users) x",
+		"SELECT s.whatever, u.name FROM stdin s JOIN users u ON s.uid = u.id",
+		"SELECT name FROM users UNION SELECT user_id FROM orders ORDER BY name",
+		"SELECT COUNT(DISTINCT name), SUM(age) FILTER (WHERE age > 30) FROM users",
+		"SELECT name, COUNT(*) FILTER (WHERE age > 30) OVER (ORDER BY id) FROM users",
+		"SELECT X.name, COUNT(*) FROM users x GROUP BY x.name",
+		"SELECT Users.profile.city FROM USERS WHERE users.age > 1",
+		"WITH Big AS (SELECT total FROM orders) SELECT big.total FROM BIG",
+		"SELECT name, MAX(age) FROM users",
+		"SELECT user_id, id, MIN(total) FROM orders GROUP BY user_id",
+	}
+	for _, input := range valid {
+		stmts, err := NewParser(strings.NewReader(input)).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if err := Analyze(stmts[0].Select, schemas); err != nil {
+			t.Errorf("%s: unexpected error: %v", input, err)
+		}
+	}
+
+	invalid := []struct {
+		input string
+		want  string
+	}{
+		{"SELECT nam FROM users", `unknown column "nam" at line 1 position 8`},
+		{"SELECT u.nam FROM users u", `unknown column "nam" in table "u" at line 1 position 8`},
+		{"SELECT name FROM users u JOIN orders o ON u.id = x.user_id", `unknown table or column "x" at line 1 position 50`},
+		{"SELECT name FROM users u WHERE users.age > 1", `unknown table "users" (it is aliased as "u") at line 1 position 32`},
+		{"SELECT name FROM users u WHERE Users.age > 1", `unknown table "Users" (it is aliased as "u") at line 1 position 32`},
+		{"SELECT x.* FROM users", `unknown table "x" in x.* at line 1 position 8`},
+		{"SELECT name,\n  X.* FROM users", `unknown table "X" in X.* at line 2 position 3`},
+		{"SELECT name,\n  COUNT(*)\nFROM users", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 8`},
+		{"SELECT name, MAX(age), MIN(age) FROM users", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 8`},
+		{"SELECT name, MAX(age) FROM users HAVING COUNT(*) > 1", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 8`},
+		{"SELECT name FROM users GROUP BY age", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 8`},
+		{"SELECT age FROM users GROUP BY age ORDER BY name", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 45`},
+		{"SELECT age FROM users GROUP BY COUNT(*)", `aggregate function COUNT is not allowed in GROUP BY at line 1 position 32`},
+		{"SELECT name FROM users WHERE age > (SELECT AVG(ag) FROM users)", `unknown column "ag" at line 1 position 48`},
+		{"SELECT t.m FROM (SELECT name AS n FROM users) t", `unknown column "m" in table "t" at line 1 position 8`},
+		{"SELECT UPPER(DISTINCT name) FROM users", `DISTINCT is only allowed in aggregate functions, not UPPER at line 1 position 8`},
+		{"SELECT COUNT(DISTINCT name, age) FROM users", `COUNT(DISTINCT ...) takes exactly one argument at line 1 position 8`},
+		{"SELECT COUNT(DISTINCT name) OVER () FROM users", `DISTINCT is not allowed in window function COUNT at line 1 position 8`},
+		{"SELECT ROW_NUMBER() FILTER (WHERE age > 1) OVER () FROM users", `FILTER is only allowed on aggregate functions, not ROW_NUMBER at line 1 position 8`},
+		{"SELECT COUNT(*) FILTER (WHERE MAX(age) > 1) FROM users", `aggregate function MAX is not allowed in FILTER at line 1 position 31`},
+		{"SELECT COUNT(*) FILTER (WHERE agee > 1) FROM users", `unknown column "agee" at line 1 position 31`},
+	}
+	for _, tt := range invalid {
+		stmts, err := NewParser(strings.NewReader(tt.input)).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.input, err)
+		}
+		err = Analyze(stmts[0].Select, schemas)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %s", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestAnalyzePaths(t *testing.T) {
+	// Columns learned from the records of stdin once read.
+	schemas := map[string][]string{"stdin": {"user", "payload"}}
+	valid := []string{
+		"SELECT payload.level, s.payload.user.id FROM stdin s",
+		"SELECT nosuchfield FROM stdin s WHERE s.x > 1",
+	}
+	for _, q := range valid {
+		stmts, err := NewParser(strings.NewReader(q)).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", q, err)
+		}
+		if err := AnalyzePaths(stmts[0].Select, schemas); err != nil {
+			t.Errorf("%s: unexpected error: %v", q, err)
+		}
+	}
+
+	stmts, err := NewParser(strings.NewReader("SELECT s.user,\n  x.user FROM stdin s")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without schemas any table might have a column x, so x.user is a path.
+	if err := Analyze(stmts[0].Select, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = AnalyzePaths(stmts[0].Select, schemas)
+	if want := `unknown table or column "x" at line 2 position 3`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	valid := map[string]time.Duration{
+		"90s":                90 * time.Second,
+		" 1h30m ":            90 * time.Minute,
+		"-5m":                -5 * time.Minute,
+		"7d":                 7 * 24 * time.Hour,
+		"1d12h":              36 * time.Hour,
+		"2w":                 14 * 24 * time.Hour,
+		"1 day":              24 * time.Hour,
+		"5 minutes":          5 * time.Minute,
+		"2 Hours 30 mins":    150 * time.Minute,
+		"1 day, 2 hrs":       26 * time.Hour,
+		"1.5 hours":          90 * time.Minute,
+		"-1 week":            -7 * 24 * time.Hour,
+		"250 milliseconds":   250 * time.Millisecond,
+		"3 seconds 500 ms":   3500 * time.Millisecond,
+		"10 microseconds 5s": 5*time.Second + 10*time.Microsecond,
+	}
+	for s, want := range valid {
+		if got, err := ParseInterval(s); err != nil || got != want {
+			t.Errorf("ParseInterval(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "day", "1 month", "2 years", "5 fortnights", "1 day 2", "--1d", "1..5h"} {
+		if got, err := ParseInterval(s); err == nil {
+			t.Errorf("ParseInterval(%q) = %v, want an error", s, got)
+		}
+	}
+
+	_, err := NewParser(strings.NewReader("SELECT a FROM t WHERE ts > now() - INTERVAL '1 month'")).Parse()
+	want := "invalid interval '1 month': expected a duration such as '90s', '1h30m', '7d' or '2 hours 30 minutes'"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %v, want it to contain %s", err, want)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		input    string
+		line     int
+		pos      int
+		expected []TokenType
+		hint     string
+	}{
+		{"SELCT a FROM t", 1, 1, []TokenType{SELECT, WITH, EXPLAIN}, "did you mean SELECT?"},
+		{"SELECT a FORM t", 1, 15, []TokenType{SELECT, WITH, EXPLAIN}, `did you mean FROM instead of "FORM"?`},
+		{"SELECT a FROM t WHER a > 1", 1, 22, []TokenType{SELECT, WITH, EXPLAIN}, `did you mean WHERE instead of "WHER"?`},
+		{"SELECT a,\n  b FROM t\n  GROUP BY a HAVNG b > 1", 3, 14, []TokenType{SELECT, WITH, EXPLAIN}, "did you mean HAVING?"},
+		{"SELECT * FROM a JOIN b USING id", 1, 30, []TokenType{LPAREN}, ""},
+		{"SELECT COUNT(a b) FROM t", 1, 16, []TokenType{COMMA, RPAREN}, ""},
+		{"SELECT 'abc FROM t", 1, 8, nil, ""},
+		{"SELECT a FROM t WHERE ts > TIMESTAMP '2024-13-01'", 1, 38, nil, ""},
+		{"SELECT a FROM t WHERE d = DATE '2024-05-01T10:00:00Z'", 1, 32, nil, ""},
+		{"SELECT a FROM t WHERE ts > now() - INTERVAL '1 month'", 1, 45, nil, ""},
+	}
+	for _, tt := range tests {
+		_, err := NewParser(strings.NewReader(tt.input)).Parse()
+		var synErr *SyntaxError
+		if !errors.As(err, &synErr) {
+			t.Errorf("%q: expected *SyntaxError, got %v", tt.input, err)
+			continue
+		}
+		if synErr.Token.Line != tt.line || synErr.Token.Pos != tt.pos {
+			t.Errorf("%q: error at line %d position %d, want line %d position %d", tt.input, synErr.Token.Line, synErr.Token.Pos, tt.line, tt.pos)
+		}
+		if fmt.Sprint(synErr.Expected) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: expected %v, want %v", tt.input, synErr.Expected, tt.expected)
+		}
+		if synErr.Hint != tt.hint {
+			t.Errorf("%q: hint %q, want %q", tt.input, synErr.Hint, tt.hint)
+		}
+	}
+
+	err := &SyntaxError{Token: &Token{Line: 2, Pos: 5}, Msg: `expected FROM but got "FORM"`, Hint: "did you mean FROM?"}
+	if got := err.Error(); got != `expected FROM but got "FORM" at line 2 position 5 (did you mean FROM?)` {
+		t.Errorf("Error() = %s", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			input: "select count(*) from stdin over 5m",
+			want:  "SELECT COUNT(*)\nFROM stdin\nOVER 5m;\n",
+		},
+		{
+			input: "select s.action,u.name as who from stdin s left outer join users u on s.uid=u.id where (a or b) and c limit 5 offset 1",
+			want: `SELECT
+  s.action,
+  u.name AS who
+FROM stdin s
+LEFT JOIN users u ON s.uid = u.id
+WHERE (a OR b) AND c
+LIMIT 5 OFFSET 1;
+`,
+		},
+		{
+			input: "SELECT name FROM users WHERE id IN (SELECT uid FROM orders)",
+			want: `SELECT name
+FROM users
+WHERE id IN (
+  SELECT uid
+  FROM orders
+);
+`,
+		},
+		{
+			input: `-- slow requests
+SELECT host, -- which box
+  latency
+FROM stdin
+-- only errors
+WHERE status >= 500 -- server side
+OVER 1m; -- per minute
+SELECT 1`,
+			want: `-- slow requests
+SELECT
+  host, -- which box
+  latency
+FROM stdin
+-- only errors
+WHERE status >= 500 -- server side
+OVER 1m; -- per minute
+
+SELECT 1;
+`,
+		},
+		{
+			input: "#!/usr/bin/env -S csql -f\n/* daily\n   report */\nselect a from t; select b /* why */ from u",
+			want: `#!/usr/bin/env -S csql -f
+/* daily
+   report */
+SELECT a
+FROM t;
+
+SELECT b /* why */
+FROM u;
+`,
+		},
+		{
+			input: "select count ( distinct user ) filter ( where ok ) over (), count(*) filter (where a = 1) from stdin",
+			want:  "SELECT\n  COUNT(DISTINCT user) FILTER (WHERE ok) OVER (),\n  COUNT(*) FILTER (WHERE a = 1)\nFROM stdin;\n",
+		},
+		{
+			input: "select glob('a*', x), regexp('b', x) from t where x ilike 'a%' or x~'^b' or x not regexp 'c' and x not glob 'd*'",
+			want:  "SELECT\n  GLOB('a*', x),\n  REGEXP('b', x)\nFROM t\nWHERE x ILIKE 'a%' OR x ~ '^b' OR x NOT REGEXP 'c' AND x NOT GLOB 'd*';\n",
+		},
+		{
+			input: "select date(timestamp), timestamp from t where timestamp > now() - interval '5m' and date between date '2024-05-01' and timestamp '2024-05-02 10:00' + 90s",
+			want:  "SELECT\n  DATE(timestamp),\n  timestamp\nFROM t\nWHERE timestamp > NOW() - INTERVAL '5m' AND date BETWEEN DATE '2024-05-01' AND TIMESTAMP '2024-05-02 10:00' + 90s;\n",
+		},
+		{
+			input: "select `a b`.x, [select], \"it's\" as [a\"b] from app.\"order items\" `a b` join users using ([user id])",
+			want:  "SELECT\n  \"a b\".x,\n  \"select\",\n  \"it's\" AS \"a\"\"b\"\nFROM app.\"order items\" \"a b\"\nJOIN users USING (\"user id\");\n",
+		},
+		{
+			input: "explain select count(*) from stdin; select 1",
+			want:  "EXPLAIN\nSELECT COUNT(*)\nFROM stdin;\n\nSELECT 1;\n",
+		},
+		{
+			input: "select * from a, b cross join c, d, e left join f on f.x = e.x, g",
+			want: `SELECT *
+FROM a, b
+CROSS JOIN c,
+  d, e
+LEFT JOIN f ON f.x = e.x,
+  g;
+`,
+		},
+		{
+			input: "select * from a -- first\n, b cross join c\n-- why d\n, d",
+			want: `SELECT *
+FROM a, -- first
+  b
+CROSS JOIN c,
+  -- why d
+  d;
+`,
+		},
+	}
+	for _, tt := range tests {
+		stmts, err := NewParser(strings.NewReader(tt.input)).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.input, err)
+		}
+		if got := Format(stmts); got != tt.want {
+			t.Errorf("%s\nwant:\n%s\ngot:\n%s", tt.input, tt.want, got)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	stmts, err := NewParser(strings.NewReader(`WITH recent AS (SELECT id FROM events WHERE ts > 10)
+SELECT u.name, CASE WHEN count(*) > 1 THEN 'many' END, payload.user.id
+FROM users u
+JOIN (SELECT uid FROM orders) o ON o.uid = u.id
+WHERE u.id IN (SELECT id FROM recent) AND NOT EXISTS (SELECT 1 FROM bans b WHERE b.uid = u.id)
+GROUP BY u.name
+ORDER BY row_number() OVER (PARTITION BY u.name ORDER BY u.id)`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := stmts[0].Select
+
+	var tables, columns []string
+	var pre, post int
+	Inspect(sel, func(n Node) bool {
+		switch n := n.(type) {
+		case *TableRef:
+			if n.Name != "" {
+				tables = append(tables, n.Name)
+			}
+		case *ColumnRef:
+			columns = append(columns, n.Table+"."+n.Column)
+		}
+		return true
+	})
+	Walk(countVisitor{&pre, &post}, sel)
+
+	if got, want := strings.Join(tables, " "), "events users orders recent bans"; got != want {
+		t.Errorf("tables = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(columns, " "), ".id .ts u.name .payload .uid o.uid u.id u.id .id b.uid u.id u.name u.name u.id"; got != want {
+		t.Errorf("columns = %q, want %q", got, want)
+	}
+	if pre != post {
+		t.Errorf("Visit called with %d nodes but %d times with nil", pre, post)
+	}
+
+	// Returning false skips the subtree.
+	var subs int
+	Inspect(sel, func(n Node) bool {
+		if s, ok := n.(*SelectStatement); ok && s != sel {
+			subs++
+			return false
+		}
+		return true
+	})
+	if want := len(sel.Subqueries()); subs != want || subs != 4 {
+		t.Errorf("got %d subqueries, want 4", subs)
+	}
+}
+
+type countVisitor struct{ pre, post *int }
+
+func (v countVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		*v.post++
+	} else {
+		*v.pre++
+	}
+	return v
+}
+
+func TestRewrite(t *testing.T) {
+	stmts, err := NewParser(strings.NewReader("SELECT a + 1 FROM t WHERE b IN (SELECT b FROM u WHERE c = 2) ORDER BY d")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := stmts[0].Select
+	Rewrite(sel, nil, func(expr Expression) Expression {
+		switch e := expr.(type) {
+		case *ColumnRef:
+			return &FunctionExpr{Name: "LOWER", Args: []Expression{e}}
+		case *LiteralExpr:
+			return &BinaryExpr{Op: STAR, Left: e, Right: &LiteralExpr{Type: NUMERIC, Value: "10"}}
+		}
+		return expr
+	})
+	want := `SELECT LOWER(a) + 1 * 10
+FROM t
+WHERE LOWER(b) IN (
+  SELECT LOWER(b)
+  FROM u
+  WHERE LOWER(c) = 2 * 10
+)
+ORDER BY LOWER(d)`
+	if got := sel.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// pre can leave subqueries alone.
+	expr := RewriteExpr(sel.Where, func(n Node) bool {
+		_, ok := n.(*SelectStatement)
+		return !ok
+	}, func(expr Expression) Expression {
+		if e, ok := expr.(*FunctionExpr); ok {
+			return e.Args[0]
+		}
+		return expr
+	})
+	if got, want := FormatExpr(expr), "b IN (\n  SELECT LOWER(b)\n  FROM u\n  WHERE LOWER(c) = 2 * 10\n)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if RewriteExpr(nil, nil, nil) != nil {
+		t.Error("rewriting nil should give nil")
+	}
+}
+
+func TestParams(t *testing.T) {
+	stmts, err := NewParser(strings.NewReader("SELECT :b, ?, $3, ?, :a FROM t WHERE x IN (SELECT :b); SELECT ?, :a")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range stmts[0].Select.Params() {
+		got = append(got, fmt.Sprintf("%s=%d", FormatExpr(p), p.Index))
+	}
+	if want := "[$1=1 $3=3 $4=4 :b=5 :a=6]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	// Each statement is numbered on its own.
+	got = nil
+	for _, p := range stmts[1].Select.Params() {
+		got = append(got, fmt.Sprintf("%s=%d", FormatExpr(p), p.Index))
+	}
+	if want := "[$1=1 :a=2]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	for _, input := range []string{"SELECT $0", "SELECT ?40000"} {
+		if _, err := NewParser(strings.NewReader(input)).Parse(); err == nil || !strings.Contains(err.Error(), "parameter number must be between 1 and 32766") {
+			t.Errorf("%s: expected parameter number error, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ast
+
+import "strings"
+
+// resolvePaths decides what each dotted name in s refers to. "a.b" is a column
+// of table a when a is a table name or alias in scope, and otherwise key b of
+// the JSON column a. The parser cannot tell the two apart on its own because
+// FROM comes after the SELECT list. outer holds the tables visible to a
+// correlated subquery. Table names and aliases match without regard to case,
+// as in SQLite, so scope holds them in lower case.
+func resolvePaths(s *SelectStatement, outer map[string]bool) {
+	scope := make(map[string]bool, len(outer))
+	for name := range outer {
+		scope[name] = true
+	}
+	if s.From != nil {
+		scope[strings.ToLower(tableRefName(s.From.Table))] = true
+	}
+	for _, j := range s.Joins {
+		scope[strings.ToLower(tableRefName(j.Table))] = true
+	}
+
+	Rewrite(s, func(n Node) bool {
+		switch n := n.(type) {
+		case *CTE:
+			resolvePaths(n.Select, outer)
+			return false
+		case *CompoundSelect:
+			resolvePaths(n.Select, outer)
+			return false
+		case *TableRef:
+			if n.Subquery != nil {
+				resolvePaths(n.Subquery, outer)
+			}
+			return false
+		case *SelectStatement:
+			// A subquery in an expression, which sees the tables of s.
+			if n != s {
+				resolvePaths(n, scope)
+				return false
+			}
+		case *PathExpr:
+			if n.Column.Table != "" && !scope[strings.ToLower(n.Column.Table)] {
+				n.Path = append([]PathStep{{Key: n.Column.Column}}, n.Path...)
+				n.Column = &ColumnRef{Column: n.Column.Table, Position: n.Column.Position}
+			}
+			return false
+		}
+		return true
+	}, func(expr Expression) Expression {
+		if e, ok := expr.(*ColumnRef); ok && e.Table != "" && e.Column != "*" && !scope[strings.ToLower(e.Table)] {
+			return &PathExpr{Column: &ColumnRef{Column: e.Table, Position: e.Position}, Path: []PathStep{{Key: e.Column}}}
+		}
+		return expr
+	})
+}
+
+// tableRefName is the name a table is referred to by in the rest of a query:
+// its alias if it has one, and otherwise its name.
+func tableRefName(ref TableRef) string {
+	if ref.Alias != "" {
+		return ref.Alias
+	}
+	return ref.Name
+}
@@ -0,0 +1,17 @@
+package ast
+
+// Subqueries returns the SELECT statements nested directly inside s: common table
+// expressions, members of a compound SELECT, derived tables in FROM and JOIN, and
+// IN, EXISTS, and scalar subqueries in any expression. Subqueries of those
+// subqueries are not included.
+func (s *SelectStatement) Subqueries() []*SelectStatement {
+	var subs []*SelectStatement
+	Inspect(s, func(n Node) bool {
+		if sub, ok := n.(*SelectStatement); ok && sub != s {
+			subs = append(subs, sub)
+			return false
+		}
+		return true
+	})
+	return subs
+}
@@ -0,0 +1,131 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// timeLayouts are the forms of date and time ParseTime accepts: RFC 3339 and
+// the same with a space for the T, each with or without fractional seconds and
+// zone, and a bare date.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses s as a date and time, as in TIMESTAMP and DATE literals and
+// in data compared with them. A time without a zone is in UTC.
+func ParseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Time returns the value of a TIMESTAMP or DATE literal. A DATE is midnight
+// UTC, and must have no time of day.
+func (e *LiteralExpr) Time() (time.Time, error) {
+	s := e.Unquoted()
+	if e.Type == DATE {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return time.Time{}, errors.New("expected YYYY-MM-DD")
+		}
+		return t, nil
+	}
+	t, ok := ParseTime(s)
+	if !ok {
+		return time.Time{}, errors.New("expected RFC 3339, as in '2024-05-01T12:00:00Z'")
+	}
+	return t, nil
+}
+
+// Duration returns the value of a DURATION or INTERVAL literal.
+func (e *LiteralExpr) Duration() (time.Duration, error) {
+	switch e.Type {
+	case DURATION:
+		return time.ParseDuration(e.Value)
+	case INTERVAL:
+		return ParseInterval(e.Unquoted())
+	}
+	return 0, fmt.Errorf("%s literal is not a duration", e.Type)
+}
+
+// intervalUnits are the units ParseInterval accepts beyond Go's, by name. Months
+// and years are left out, since they are not of a fixed length.
+var intervalUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "nanosecond": time.Nanosecond,
+	"us": time.Microsecond, "µs": time.Microsecond, "microsecond": time.Microsecond,
+	"ms": time.Millisecond, "millisecond": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour,
+}
+
+// ParseInterval parses the text of an INTERVAL literal: a Go duration such as
+// "1h30m", or a sequence of amounts and units, which may be spelled out and
+// spaced as in "1 day 2 hours" or written like a duration as in "7d". Days
+// and weeks are 24 hours and 7 days. A leading minus sign negates the whole.
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	errInvalid := errors.New("expected a duration such as '90s', '1h30m', '7d' or '2 hours 30 minutes'")
+
+	rest, neg := strings.CutPrefix(s, "-")
+	var total float64
+	parts := 0
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		n := strings.IndexFunc(rest, func(r rune) bool { return !('0' <= r && r <= '9' || r == '.') })
+		if n == 0 {
+			return 0, errInvalid
+		}
+		if n < 0 {
+			n = len(rest)
+		}
+		amount, err := strconv.ParseFloat(rest[:n], 64)
+		if err != nil {
+			return 0, errInvalid
+		}
+		rest = strings.TrimSpace(rest[n:])
+		n = strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) })
+		if n < 0 {
+			n = len(rest)
+		}
+		unit := strings.ToLower(rest[:n])
+		per, ok := intervalUnits[unit]
+		if !ok {
+			per, ok = intervalUnits[strings.TrimSuffix(unit, "s")]
+		}
+		if !ok {
+			return 0, errInvalid
+		}
+		total += amount * float64(per)
+		rest = strings.TrimPrefix(strings.TrimSpace(rest[n:]), ",")
+		parts++
+	}
+	if parts == 0 || math.Abs(total) > math.MaxInt64 {
+		return 0, errInvalid
+	}
+	if neg {
+		total = -total
+	}
+	return time.Duration(total), nil
+}
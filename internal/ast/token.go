@@ -47,24 +47,31 @@ const (
 	WS
 
 	// Symbols
-	STAR      // *
-	COMMA     // ,
-	DOT       // .
-	LPAREN    // (
-	RPAREN    // )
-	LBRACKET  // [
-	RBRACKET  // ]
-	EQ        // =
-	NEQ       // !=
-	LT        // <
-	LTE       // <=
-	GT        // >
-	GTE       // >=
-	PLUS      // +
-	MINUS     // -
-	SLASH     // /
-	PERCENT   // %
-	SEMICOLON // ;
+	STAR       // *
+	COMMA      // ,
+	DOT        // .
+	LPAREN     // (
+	RPAREN     // )
+	LBRACKET   // [
+	RBRACKET   // ]
+	EQ         // =
+	NEQ        // !=
+	LT         // <
+	LTE        // <=
+	GT         // >
+	GTE        // >=
+	PLUS       // +
+	MINUS      // -
+	SLASH      // /
+	PERCENT    // %
+	SEMICOLON  // ;
+	COLONCOLON // ::
+	CONCAT     // ||
+	AMPERSAND  // &
+	PIPE       // |
+	LSHIFT     // <<
+	RSHIFT     // >>
+	TILDE      // ~
 
 	// Keywords
 	SELECT
@@ -87,6 +94,7 @@ const (
 	WITHIN
 	GROUP
 	BY
+	HAVING
 	ORDER
 	ASC
 	DESC
@@ -102,6 +110,28 @@ const (
 	LEFT
 	RIGHT
 	LIKE
+	ILIKE
+	GLOB
+	REGEXP
+	CASE
+	WHEN
+	THEN
+	ELSE
+	END
+	CAST
+	EXISTS
+	WITH
+	RECURSIVE
+	UNION
+	ALL
+	INTERSECT
+	EXCEPT
+	INNER
+	OUTER
+	FULL
+	CROSS
+	USING
+	EXPLAIN
 
 	// Literals
 	STRING   // 'foo', "foo"
@@ -110,6 +140,15 @@ const (
 	TRUE     // true|TRUE
 	FALSE    // false|FALSE
 
+	// Typed literals, which the parser makes of a word and a STRING. The words
+	// are not keywords, so they remain usable as names.
+	TIMESTAMP // TIMESTAMP '2024-05-01T12:00:00Z'
+	DATE      // DATE '2024-05-01'
+	INTERVAL  // INTERVAL '90m'
+
 	// Identifiers
 	IDENT // table_name, field_name, alias, "ident"
+
+	// Parameters
+	PARAM // :name, $1, ?
 )
@@ -30,52 +30,86 @@ func _() {
 	_ = x[SLASH-19]
 	_ = x[PERCENT-20]
 	_ = x[SEMICOLON-21]
-	_ = x[SELECT-22]
-	_ = x[DISTINCT-23]
-	_ = x[COUNT-24]
-	_ = x[SUM-25]
-	_ = x[MAX-26]
-	_ = x[MIN-27]
-	_ = x[AVG-28]
-	_ = x[AS-29]
-	_ = x[FROM-30]
-	_ = x[OVER-31]
-	_ = x[WHERE-32]
-	_ = x[AND-33]
-	_ = x[OR-34]
-	_ = x[NOT-35]
-	_ = x[IN-36]
-	_ = x[IS-37]
-	_ = x[BETWEEN-38]
-	_ = x[WITHIN-39]
-	_ = x[GROUP-40]
-	_ = x[BY-41]
-	_ = x[ORDER-42]
-	_ = x[ASC-43]
-	_ = x[DESC-44]
-	_ = x[LIMIT-45]
-	_ = x[NULL-46]
-	_ = x[EVERY-47]
-	_ = x[CONSUME-48]
-	_ = x[SELF-49]
-	_ = x[EDGE-50]
-	_ = x[TREE-51]
-	_ = x[JOIN-52]
-	_ = x[ON-53]
-	_ = x[LEFT-54]
-	_ = x[RIGHT-55]
-	_ = x[LIKE-56]
-	_ = x[STRING-57]
-	_ = x[NUMERIC-58]
-	_ = x[DURATION-59]
-	_ = x[TRUE-60]
-	_ = x[FALSE-61]
-	_ = x[IDENT-62]
+	_ = x[COLONCOLON-22]
+	_ = x[CONCAT-23]
+	_ = x[AMPERSAND-24]
+	_ = x[PIPE-25]
+	_ = x[LSHIFT-26]
+	_ = x[RSHIFT-27]
+	_ = x[TILDE-28]
+	_ = x[SELECT-29]
+	_ = x[DISTINCT-30]
+	_ = x[COUNT-31]
+	_ = x[SUM-32]
+	_ = x[MAX-33]
+	_ = x[MIN-34]
+	_ = x[AVG-35]
+	_ = x[AS-36]
+	_ = x[FROM-37]
+	_ = x[OVER-38]
+	_ = x[WHERE-39]
+	_ = x[AND-40]
+	_ = x[OR-41]
+	_ = x[NOT-42]
+	_ = x[IN-43]
+	_ = x[IS-44]
+	_ = x[BETWEEN-45]
+	_ = x[WITHIN-46]
+	_ = x[GROUP-47]
+	_ = x[BY-48]
+	_ = x[HAVING-49]
+	_ = x[ORDER-50]
+	_ = x[ASC-51]
+	_ = x[DESC-52]
+	_ = x[LIMIT-53]
+	_ = x[NULL-54]
+	_ = x[EVERY-55]
+	_ = x[CONSUME-56]
+	_ = x[SELF-57]
+	_ = x[EDGE-58]
+	_ = x[TREE-59]
+	_ = x[JOIN-60]
+	_ = x[ON-61]
+	_ = x[LEFT-62]
+	_ = x[RIGHT-63]
+	_ = x[LIKE-64]
+	_ = x[ILIKE-65]
+	_ = x[GLOB-66]
+	_ = x[REGEXP-67]
+	_ = x[CASE-68]
+	_ = x[WHEN-69]
+	_ = x[THEN-70]
+	_ = x[ELSE-71]
+	_ = x[END-72]
+	_ = x[CAST-73]
+	_ = x[EXISTS-74]
+	_ = x[WITH-75]
+	_ = x[RECURSIVE-76]
+	_ = x[UNION-77]
+	_ = x[ALL-78]
+	_ = x[INTERSECT-79]
+	_ = x[EXCEPT-80]
+	_ = x[INNER-81]
+	_ = x[OUTER-82]
+	_ = x[FULL-83]
+	_ = x[CROSS-84]
+	_ = x[USING-85]
+	_ = x[EXPLAIN-86]
+	_ = x[STRING-87]
+	_ = x[NUMERIC-88]
+	_ = x[DURATION-89]
+	_ = x[TRUE-90]
+	_ = x[FALSE-91]
+	_ = x[TIMESTAMP-92]
+	_ = x[DATE-93]
+	_ = x[INTERVAL-94]
+	_ = x[IDENT-95]
+	_ = x[PARAM-96]
 }
 
-const _TokenType_name = "ILLEGALEOFCOMMENTWSSTARCOMMADOTLPARENRPARENLBRACKETRBRACKETEQNEQLTLTEGTGTEPLUSMINUSSLASHPERCENTSEMICOLONSELECTDISTINCTCOUNTSUMMAXMINAVGASFROMOVERWHEREANDORNOTINISBETWEENWITHINGROUPBYORDERASCDESCLIMITNULLEVERYCONSUMESELFEDGETREEJOINONLEFTRIGHTLIKESTRINGNUMERICDURATIONTRUEFALSEIDENT"
+const _TokenType_name = "ILLEGALEOFCOMMENTWSSTARCOMMADOTLPARENRPARENLBRACKETRBRACKETEQNEQLTLTEGTGTEPLUSMINUSSLASHPERCENTSEMICOLONCOLONCOLONCONCATAMPERSANDPIPELSHIFTRSHIFTTILDESELECTDISTINCTCOUNTSUMMAXMINAVGASFROMOVERWHEREANDORNOTINISBETWEENWITHINGROUPBYHAVINGORDERASCDESCLIMITNULLEVERYCONSUMESELFEDGETREEJOINONLEFTRIGHTLIKEILIKEGLOBREGEXPCASEWHENTHENELSEENDCASTEXISTSWITHRECURSIVEUNIONALLINTERSECTEXCEPTINNEROUTERFULLCROSSUSINGEXPLAINSTRINGNUMERICDURATIONTRUEFALSETIMESTAMPDATEINTERVALIDENTPARAM"
 
-var _TokenType_index = [...]uint16{0, 7, 10, 17, 19, 23, 28, 31, 37, 43, 51, 59, 61, 64, 66, 69, 71, 74, 78, 83, 88, 95, 104, 110, 118, 123, 126, 129, 132, 135, 137, 141, 145, 150, 153, 155, 158, 160, 162, 169, 175, 180, 182, 187, 190, 194, 199, 203, 208, 215, 219, 223, 227, 231, 233, 237, 242, 246, 252, 259, 267, 271, 276, 281}
+var _TokenType_index = [...]uint16{0, 7, 10, 17, 19, 23, 28, 31, 37, 43, 51, 59, 61, 64, 66, 69, 71, 74, 78, 83, 88, 95, 104, 114, 120, 129, 133, 139, 145, 150, 156, 164, 169, 172, 175, 178, 181, 183, 187, 191, 196, 199, 201, 204, 206, 208, 215, 221, 226, 228, 234, 239, 242, 246, 251, 255, 260, 267, 271, 275, 279, 283, 285, 289, 294, 298, 303, 307, 313, 317, 321, 325, 329, 332, 336, 342, 346, 355, 360, 363, 372, 378, 383, 388, 392, 397, 402, 409, 415, 422, 430, 434, 439, 448, 452, 460, 465, 470}
 
 func (i TokenType) String() string {
 	if i < 0 || i >= TokenType(len(_TokenType_index)-1) {
@@ -0,0 +1,366 @@
+package ast
+
+import "fmt"
+
+// Node is any part of a parsed query: a statement, a clause, or an Expression.
+// Clauses held by value in their parent, such as a Column or JoinClause, are
+// passed to Walk and Rewrite callbacks by pointer, so changes to them stick.
+type Node interface {
+	node()
+}
+
+func (*Statement) node()       {}
+func (*SelectStatement) node() {}
+func (*CompoundSelect) node()  {}
+func (*WithClause) node()      {}
+func (*CTE) node()             {}
+func (*Column) node()          {}
+func (*FromClause) node()      {}
+func (*TableRef) node()        {}
+func (*JoinClause) node()      {}
+func (*OrderByExpr) node()     {}
+func (*WindowSpec) node()      {}
+func (*WindowFrame) node()     {}
+func (*FrameBound) node()      {}
+func (*WhenClause) node()      {}
+
+func (*BinaryExpr) node()   {}
+func (*UnaryExpr) node()    {}
+func (*FunctionExpr) node() {}
+func (*ColumnRef) node()    {}
+func (*LiteralExpr) node()  {}
+func (*ParamExpr) node()    {}
+func (*StarExpr) node()     {}
+func (*IsNullExpr) node()   {}
+func (*BetweenExpr) node()  {}
+func (*InExpr) node()       {}
+func (*LikeExpr) node()     {}
+func (*CaseExpr) node()     {}
+func (*CastExpr) node()     {}
+func (*SubqueryExpr) node() {}
+func (*ExistsExpr) node()   {}
+func (*PathExpr) node()     {}
+
+// A Visitor's Visit method is called by Walk for each node. If the Visitor it
+// returns is not nil, Walk visits the children of node with it, and then calls
+// its Visit method with nil.
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, in the order
+// the parts appear in the query text. It enters every clause and every nested
+// SELECT: common table expressions, members of a compound SELECT, derived
+// tables, and subqueries in expressions.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Statement:
+		Walk(v, n.Select)
+	case *SelectStatement:
+		if n.With != nil {
+			Walk(v, n.With)
+		}
+		for i := range n.Columns {
+			Walk(v, &n.Columns[i])
+		}
+		if n.From != nil {
+			Walk(v, n.From)
+		}
+		for i := range n.Joins {
+			Walk(v, &n.Joins[i])
+		}
+		walkExpr(v, n.Where)
+		for _, expr := range n.GroupBy {
+			Walk(v, expr)
+		}
+		walkExpr(v, n.Having)
+		for i := range n.Compound {
+			Walk(v, &n.Compound[i])
+		}
+		for i := range n.OrderBy {
+			Walk(v, &n.OrderBy[i])
+		}
+	case *CompoundSelect:
+		Walk(v, n.Select)
+	case *WithClause:
+		for i := range n.CTEs {
+			Walk(v, &n.CTEs[i])
+		}
+	case *CTE:
+		Walk(v, n.Select)
+	case *Column:
+		walkExpr(v, n.Expr)
+	case *FromClause:
+		Walk(v, &n.Table)
+	case *TableRef:
+		if n.Subquery != nil {
+			Walk(v, n.Subquery)
+		}
+	case *JoinClause:
+		Walk(v, &n.Table)
+		walkExpr(v, n.Condition)
+	case *OrderByExpr:
+		Walk(v, n.Expr)
+	case *WindowSpec:
+		for _, expr := range n.PartitionBy {
+			Walk(v, expr)
+		}
+		for i := range n.OrderBy {
+			Walk(v, &n.OrderBy[i])
+		}
+		if n.Frame != nil {
+			Walk(v, n.Frame)
+		}
+	case *WindowFrame:
+		Walk(v, &n.Start)
+		if n.End != nil {
+			Walk(v, n.End)
+		}
+	case *FrameBound:
+		walkExpr(v, n.Offset)
+	case *WhenClause:
+		Walk(v, n.Cond)
+		Walk(v, n.Result)
+
+	case *BinaryExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *UnaryExpr:
+		Walk(v, n.Operand)
+	case *FunctionExpr:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+		walkExpr(v, n.Filter)
+		if n.Over != nil {
+			Walk(v, n.Over)
+		}
+	case *IsNullExpr:
+		Walk(v, n.Expr)
+	case *BetweenExpr:
+		Walk(v, n.Expr)
+		Walk(v, n.Low)
+		Walk(v, n.High)
+	case *InExpr:
+		Walk(v, n.Expr)
+		for _, val := range n.Values {
+			Walk(v, val)
+		}
+		if n.Subquery != nil {
+			Walk(v, n.Subquery)
+		}
+	case *LikeExpr:
+		Walk(v, n.Expr)
+		Walk(v, n.Pattern)
+	case *CaseExpr:
+		walkExpr(v, n.Operand)
+		for i := range n.Whens {
+			Walk(v, &n.Whens[i])
+		}
+		walkExpr(v, n.Else)
+	case *CastExpr:
+		Walk(v, n.Expr)
+	case *SubqueryExpr:
+		Walk(v, n.Select)
+	case *ExistsExpr:
+		Walk(v, n.Subquery)
+	case *PathExpr:
+		Walk(v, n.Column)
+	case *ColumnRef, *LiteralExpr, *ParamExpr, *StarExpr:
+		// no children
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// walkExpr walks expr if the optional expression is present.
+func walkExpr(v Visitor, expr Expression) {
+	if expr != nil {
+		Walk(v, expr)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in the same order as Walk. It
+// calls f(node) for each node, and visits the node's children only if f
+// returns true. f is not called with nil after the children.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(func(n Node) bool {
+		return n == nil || f(n)
+	}), node)
+}
+
+// Rewrite replaces expressions throughout s, in place. It traverses s in the
+// same order as Walk, calling pre, if it is not nil, before each node's
+// children, and post after them. Children are skipped when pre returns false,
+// and so is post. Every expression that post is called for is replaced by what
+// post returns, which may be the expression itself.
+//
+// The Column of a PathExpr must remain a *ColumnRef; post panics if it returns
+// any other expression for one.
+func Rewrite(s *SelectStatement, pre func(Node) bool, post func(Expression) Expression) {
+	r := &rewriter{pre: pre, post: post}
+	r.node(s)
+}
+
+// RewriteExpr is like Rewrite, for a single expression. It returns the
+// replacement for expr, which is nil if expr is nil.
+func RewriteExpr(expr Expression, pre func(Node) bool, post func(Expression) Expression) Expression {
+	r := &rewriter{pre: pre, post: post}
+	return r.expr(expr)
+}
+
+type rewriter struct {
+	pre  func(Node) bool
+	post func(Expression) Expression
+}
+
+func (r *rewriter) expr(expr Expression) Expression {
+	if expr == nil || (r.pre != nil && !r.pre(expr)) {
+		return expr
+	}
+	r.children(expr)
+	return r.post(expr)
+}
+
+func (r *rewriter) node(n Node) {
+	if r.pre != nil && !r.pre(n) {
+		return
+	}
+	r.children(n)
+}
+
+func (r *rewriter) exprs(exprs []Expression) {
+	for i := range exprs {
+		exprs[i] = r.expr(exprs[i])
+	}
+}
+
+func (r *rewriter) children(node Node) {
+	switch n := node.(type) {
+	case *Statement:
+		r.node(n.Select)
+	case *SelectStatement:
+		if n.With != nil {
+			r.node(n.With)
+		}
+		for i := range n.Columns {
+			r.node(&n.Columns[i])
+		}
+		if n.From != nil {
+			r.node(n.From)
+		}
+		for i := range n.Joins {
+			r.node(&n.Joins[i])
+		}
+		n.Where = r.expr(n.Where)
+		r.exprs(n.GroupBy)
+		n.Having = r.expr(n.Having)
+		for i := range n.Compound {
+			r.node(&n.Compound[i])
+		}
+		for i := range n.OrderBy {
+			r.node(&n.OrderBy[i])
+		}
+	case *CompoundSelect:
+		r.node(n.Select)
+	case *WithClause:
+		for i := range n.CTEs {
+			r.node(&n.CTEs[i])
+		}
+	case *CTE:
+		r.node(n.Select)
+	case *Column:
+		n.Expr = r.expr(n.Expr)
+	case *FromClause:
+		r.node(&n.Table)
+	case *TableRef:
+		if n.Subquery != nil {
+			r.node(n.Subquery)
+		}
+	case *JoinClause:
+		r.node(&n.Table)
+		n.Condition = r.expr(n.Condition)
+	case *OrderByExpr:
+		n.Expr = r.expr(n.Expr)
+	case *WindowSpec:
+		r.exprs(n.PartitionBy)
+		for i := range n.OrderBy {
+			r.node(&n.OrderBy[i])
+		}
+		if n.Frame != nil {
+			r.node(n.Frame)
+		}
+	case *WindowFrame:
+		r.node(&n.Start)
+		if n.End != nil {
+			r.node(n.End)
+		}
+	case *FrameBound:
+		n.Offset = r.expr(n.Offset)
+	case *WhenClause:
+		n.Cond = r.expr(n.Cond)
+		n.Result = r.expr(n.Result)
+
+	case *BinaryExpr:
+		n.Left = r.expr(n.Left)
+		n.Right = r.expr(n.Right)
+	case *UnaryExpr:
+		n.Operand = r.expr(n.Operand)
+	case *FunctionExpr:
+		r.exprs(n.Args)
+		n.Filter = r.expr(n.Filter)
+		if n.Over != nil {
+			r.node(n.Over)
+		}
+	case *IsNullExpr:
+		n.Expr = r.expr(n.Expr)
+	case *BetweenExpr:
+		n.Expr = r.expr(n.Expr)
+		n.Low = r.expr(n.Low)
+		n.High = r.expr(n.High)
+	case *InExpr:
+		n.Expr = r.expr(n.Expr)
+		r.exprs(n.Values)
+		if n.Subquery != nil {
+			r.node(n.Subquery)
+		}
+	case *LikeExpr:
+		n.Expr = r.expr(n.Expr)
+		n.Pattern = r.expr(n.Pattern)
+	case *CaseExpr:
+		n.Operand = r.expr(n.Operand)
+		for i := range n.Whens {
+			r.node(&n.Whens[i])
+		}
+		n.Else = r.expr(n.Else)
+	case *CastExpr:
+		n.Expr = r.expr(n.Expr)
+	case *SubqueryExpr:
+		r.node(n.Select)
+	case *ExistsExpr:
+		r.node(n.Subquery)
+	case *PathExpr:
+		n.Column = r.expr(n.Column).(*ColumnRef)
+	case *ColumnRef, *LiteralExpr, *ParamExpr, *StarExpr:
+		// no children
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"math"
+	"strconv"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// textFunc is the SQLite function applied to the operands of ||. Numbers are
+// stored as REAL, so SQLite would write the port 8080 as "8080.0"; textFunc
+// turns a whole number into an INTEGER first, so it is written as "8080".
+// Other values are returned unchanged.
+const textFunc = "csql_text"
+
+// boolFunc is the SQLite function behind CAST(x AS BOOLEAN), so that x is
+// evaluated once. SQLite has no boolean type, so it returns 1 or 0: true, t
+// and yes are 1 and false, f and no are 0 in any case, and anything else is 1
+// when it is a non-zero number. NULL stays NULL.
+const boolFunc = "csql_bool"
+
+// maxExactInt is the largest magnitude up to which every whole float64 is an
+// exact integer.
+const maxExactInt = 1 << 53
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(textFunc, 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if f, ok := args[0].(float64); ok && f == math.Trunc(f) && math.Abs(f) <= maxExactInt {
+			return int64(f), nil
+		}
+		return args[0], nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction(boolFunc, 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var b bool
+		switch v := args[0].(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			b = v != 0
+		case float64:
+			b = v != 0
+		case []byte:
+			b = parseBool(string(v))
+		case string:
+			b = parseBool(v)
+		}
+		if b {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	})
+}
+
+// parseBool reports whether s spells true, or else is a non-zero number.
+func parseBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "t", "yes":
+		return true
+	case "false", "f", "no":
+		return false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil && f != 0
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +19,11 @@ import (
 type Engine struct {
 	sources      map[string]source.Source
 	staticTables map[string]bool
+	params       map[string]interface{}
+	replay       bool                       // keep records for later statements
+	loaded       map[string][]source.Record // records kept for later statements
+	tagKey       string
+	tagValue     interface{}
 	output       io.Writer
 }
 
@@ -26,6 +32,8 @@ func New(out io.Writer) *Engine {
 	return &Engine{
 		sources:      make(map[string]source.Source),
 		staticTables: make(map[string]bool),
+		params:       make(map[string]interface{}),
+		loaded:       make(map[string][]source.Record),
 		output:       out,
 	}
 }
@@ -38,81 +46,233 @@ func (e *Engine) AddSource(s source.Source) {
 	}
 }
 
-// Execute runs a parsed statement.
+// SetParam sets the value of a query parameter. A name binds :name, and a
+// number n binds $n and the nth ?.
+func (e *Engine) SetParam(name string, value interface{}) {
+	e.params[name] = value
+}
+
+// SetReplay sets whether the records read from each source are kept, to be
+// replayed to later statements, as a script of several statements needs. A
+// source can only be read once, so without it each source serves one statement,
+// and its records are not copied.
+func (e *Engine) SetReplay(replay bool) {
+	e.replay = replay
+}
+
+// SetTag adds a key field with value to every row written from now on, as a
+// script does to tell apart the output of its statements. It replaces a column
+// of the same name. An empty key removes the tag.
+func (e *Engine) SetTag(key string, value interface{}) {
+	e.tagKey, e.tagValue = key, value
+}
+
+// Execute runs a parsed statement. An Engine can run any number of statements
+// in turn; with SetReplay, sources are read once and their records replayed to
+// later ones.
 func (e *Engine) Execute(stmt *ast.SelectStatement) error {
+	e.sourceNames(stmt)
+	schemas, err := e.schemas(stmt)
+	if err != nil {
+		return err
+	}
+	if err := ast.Analyze(stmt, schemas); err != nil {
+		return err
+	}
+	args, err := e.bindArgs(stmt)
+	if err != nil {
+		return err
+	}
 	if stmt.Over > 0 {
-		return e.executeStreaming(stmt)
+		return e.executeStreaming(stmt, args)
+	}
+	return e.executeBatch(stmt, schemas, args)
+}
+
+// bindArgs returns the values of the parameters in stmt, in the order the SQL
+// generated for it numbers them.
+func (e *Engine) bindArgs(stmt *ast.SelectStatement) ([]interface{}, error) {
+	params := stmt.Params()
+	if len(params) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, params[len(params)-1].Index)
+	for _, p := range params {
+		name := p.Name
+		if name == "" {
+			name = strconv.Itoa(p.Index)
+		}
+		v, ok := e.params[name]
+		if !ok {
+			// Name the parameter as the user wrote it, with the number that
+			// binds it when that is not part of the text.
+			written := p.Text
+			if written == "?" {
+				written = fmt.Sprintf("? (number %d)", p.Index)
+			}
+			return nil, &ast.SemanticError{
+				Msg:      fmt.Sprintf("no value for parameter %s", written),
+				Position: p.Position,
+			}
+		}
+		args[p.Index-1] = v
 	}
-	return e.executeBatch(stmt)
+	return args, nil
 }
 
-// attachable is the interface for sources that can be ATTACHed directly.
+// sourceNames renames the tables stmt reads from sources, and the schemas of its
+// schema-qualified tables, to the names the sources were added under. SQLite
+// matches names without regard to case, so FROM USERS reads the source users,
+// while sources are looked up by their own names from here on.
+func (e *Engine) sourceNames(stmt *ast.SelectStatement) {
+	names := make(map[string]string, len(e.sources))
+	for name := range e.sources {
+		names[strings.ToLower(name)] = name
+	}
+	for _, u := range collectTableUses(stmt) {
+		switch {
+		case u.ref.Subquery != nil:
+		case u.ref.Schema != "":
+			if name, ok := names[strings.ToLower(u.ref.Schema)]; ok {
+				u.ref.Schema = name
+			}
+		default:
+			if name, ok := names[strings.ToLower(u.ref.Name)]; ok {
+				u.ref.Name = name
+			}
+		}
+	}
+}
+
+// schemas returns the column names of each source that knows them up front,
+// and of each table stmt reads from a SQLite source's database as
+// source.table. A source that fails to report its own columns is left to fail
+// when it is read, but a schema-qualified table that cannot be found is an
+// error, since SQLite would otherwise report it as an empty source.
+func (e *Engine) schemas(stmt *ast.SelectStatement) (map[string][]string, error) {
+	schemas := make(map[string][]string)
+	for name, src := range e.sources {
+		if cl, ok := src.(source.ColumnLister); ok {
+			if cols, err := cl.Columns(); err == nil && cols != nil {
+				schemas[name] = cols
+			}
+		}
+	}
+	for _, ref := range qualifiedTables(stmt) {
+		src, ok := e.sources[ref.Schema]
+		if !ok {
+			return nil, &ast.SemanticError{Msg: fmt.Sprintf("unknown schema %q in %s", ref.Schema, ref.QualifiedName())}
+		}
+		att, ok := src.(attachable)
+		if !ok {
+			return nil, &ast.SemanticError{Msg: fmt.Sprintf("source %q is not a SQLite database, so has no table %s", ref.Schema, ref.QualifiedName())}
+		}
+		cols, err := att.TableColumns(ref.Name)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", ref.Schema, err)
+		}
+		schemas[ref.QualifiedName()] = cols
+	}
+	return schemas, nil
+}
+
+// attachable is the interface for sources that can be ATTACHed directly. The
+// source reads TableName, but any table of the database can be queried.
 type attachable interface {
 	DBPath() string
 	TableName() string
+	TableColumns(table string) ([]string, error)
 }
 
-func (e *Engine) executeBatch(stmt *ast.SelectStatement) error {
+// batchPlans plans the sources stmt reads, for a query without OVER, which
+// reads each of them in full: SQLite sources are attached, and the rest are
+// loaded into the query's own database.
+func (e *Engine) batchPlans(stmt *ast.SelectStatement) map[string]*BatchTablePlan {
+	used := usedSources(stmt)
+	plans := make(map[string]*BatchTablePlan)
+	for name, src := range e.sources {
+		if !used[strings.ToLower(name)] {
+			continue
+		}
+		if att, ok := src.(attachable); ok {
+			plans[name] = &BatchTablePlan{
+				Access:     AccessAttached,
+				Schema:     "_src_" + name,
+				SQLTable:   att.TableName(),
+				AttachPath: att.DBPath(),
+			}
+			continue
+		}
+		plans[name] = &BatchTablePlan{
+			Access:   AccessFullScan,
+			SQLTable: name,
+		}
+	}
+	return plans
+}
+
+func (e *Engine) executeBatch(stmt *ast.SelectStatement, schemas map[string][]string, args []interface{}) error {
 	db, err := sql.Open("sqlite", ":memory:")
 	if err != nil {
 		return fmt.Errorf("open sqlite: %w", err)
 	}
 	defer db.Close()
 
-	// Check for SQLite sources that can be ATTACHed directly
-	attachSchemas := make(map[string]string) // source name → schema for SQL generation
-	for name, src := range e.sources {
-		if att, ok := src.(attachable); ok {
-			schema := "_src_" + name
+	// Attach SQLite sources directly and load the rest into the DB
+	plans := e.batchPlans(stmt)
+	for name, plan := range plans {
+		if plan.Access == AccessAttached {
 			_, err := db.Exec(fmt.Sprintf(
 				"ATTACH DATABASE %s AS %s",
-				quoteLiteral(att.DBPath()), quoteIdent(schema)))
+				quoteLiteral(plan.AttachPath), quoteIdent(plan.Schema)))
 			if err != nil {
 				return fmt.Errorf("attach %s: %w", name, err)
 			}
-			attachSchemas[name] = schema
 			continue
 		}
 
-		// Load non-SQLite sources into the DB
-		ch, err := src.Records()
+		ch, err := e.records(name, true)
 		if err != nil {
 			return fmt.Errorf("source %s: %w", name, err)
 		}
 		for rec := range ch {
 			if err := insertRecord(db, name, rec); err != nil {
+				drain(ch)
 				return fmt.Errorf("insert into %s: %w", name, err)
 			}
 		}
 	}
 
-	// Build plans for SQL generation with correct table names
-	var plans map[string]*BatchTablePlan
-	var tableSchemas map[string]string
-	if len(attachSchemas) > 0 {
-		plans = make(map[string]*BatchTablePlan)
-		tableSchemas = make(map[string]string)
-		for name, schema := range attachSchemas {
-			att := e.sources[name].(attachable)
-			plans[name] = &BatchTablePlan{
-				Access:   AccessAttached,
-				Schema:   schema,
-				SQLTable: att.TableName(),
-			}
-			tableSchemas[name] = schema
+	// Sources that cannot list their columns up front, such as stdin and JSON
+	// lines, have them once loaded, so check the paths in stmt against those.
+	// SQLite reads a double-quoted name that is not a column as a string, and
+	// would otherwise read x.user, for a mistyped qualifier x, as a path into the
+	// text "x".
+	unchecked := false
+	for name, plan := range plans {
+		if _, ok := schemas[name]; ok || plan.Access != AccessFullScan {
+			continue
+		}
+		cols, err := loadedColumns(db, name)
+		if err != nil {
+			return fmt.Errorf("source %s: %w", name, err)
+		}
+		if cols != nil {
+			schemas[name] = cols
+			unchecked = true
+		}
+	}
+	if unchecked {
+		if err := ast.AnalyzePaths(stmt, schemas); err != nil {
+			return err
 		}
 	}
 
 	// Convert AST to SQL
-	var sqlStr string
-	if plans != nil {
-		sqlStr = ToSQLWithPlans(stmt, tableSchemas, plans)
-	} else {
-		sqlStr = ToSQL(stmt, nil)
-	}
+	sqlStr := ToSQLWithPlans(stmt, BuildTableSchemas(plans), plans)
 
 	// Execute
-	rows, err := db.Query(sqlStr)
+	rows, err := db.Query(sqlStr, args...)
 	if err != nil {
 		// A source with 0 records never creates its table — treat as empty result.
 		if isNoSuchTableErr(err) {
@@ -122,15 +282,58 @@ func (e *Engine) executeBatch(stmt *ast.SelectStatement) error {
 	}
 	defer rows.Close()
 
-	return e.writeRows(rows)
+	return e.writeRows(rows, outputCasts(stmt))
+}
+
+// records returns the records of the named source. A source can only be read
+// once, so when keep is set and the engine replays records, they are kept as
+// they are read, to be replayed to later statements. Kept records are replayed
+// whatever keep is.
+// Streaming sources read by a windowed query are not kept, since they may not
+// end.
+func (e *Engine) records(name string, keep bool) (<-chan source.Record, error) {
+	if recs, ok := e.loaded[name]; ok {
+		ch := make(chan source.Record, len(recs))
+		for _, rec := range recs {
+			ch <- rec
+		}
+		close(ch)
+		return ch, nil
+	}
+
+	ch, err := e.sources[name].Records()
+	if err != nil || !keep || !e.replay {
+		return ch, err
+	}
+	out := make(chan source.Record, 64)
+	go func() {
+		var recs []source.Record
+		for rec := range ch {
+			recs = append(recs, rec)
+			out <- rec
+		}
+		// Stored before out is closed, so the statement reading out finishes
+		// after the records are in place for the next one.
+		e.loaded[name] = recs
+		close(out)
+	}()
+	return out, nil
+}
+
+// drain reads what is left of ch, for a statement that stops reading a source
+// early. Otherwise the goroutine sending on ch would block for good, and a kept
+// source would never have its records stored for the next statement.
+func drain(ch <-chan source.Record) {
+	for range ch {
+	}
 }
 
 // IndexedTable holds a Go-side hash map for on-demand insertion of batch rows.
 type IndexedTable struct {
-	name      string                           // table name in window DB
-	joinCol   string                           // column indexed on (in the batch table)
-	streamCol string                           // column to look up from streaming record
-	records   map[interface{}][]source.Record   // joinKey → matching batch records
+	name       string                          // table name in window DB
+	joinCols   []string                        // columns indexed on (in the batch table)
+	streamCols []string                        // columns to look up from streaming record
+	records    map[interface{}][]source.Record // joinKey → matching batch records
 }
 
 // taggedRecord associates a record with its source table name.
@@ -140,14 +343,14 @@ type taggedRecord struct {
 }
 
 // mergeStreams fans-in multiple streaming source channels into one tagged channel.
-func mergeStreams(sources map[string]source.Source) (<-chan taggedRecord, error) {
+func (e *Engine) mergeStreams(sources map[string]source.Source) (<-chan taggedRecord, error) {
 	merged := make(chan taggedRecord, 64)
 	var wg sync.WaitGroup
 	for name, src := range sources {
 		if src.Type() != source.Streaming {
 			continue
 		}
-		ch, err := src.Records()
+		ch, err := e.records(name, false)
 		if err != nil {
 			return nil, fmt.Errorf("source %s: %w", name, err)
 		}
@@ -166,7 +369,7 @@ func mergeStreams(sources map[string]source.Source) (<-chan taggedRecord, error)
 	return merged, nil
 }
 
-func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
+func (e *Engine) executeStreaming(stmt *ast.SelectStatement, args []interface{}) error {
 	// Collect streaming sources
 	streamingSources := make(map[string]source.Source)
 	for name, src := range e.sources {
@@ -188,7 +391,6 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 	staticTables := make(map[string]bool)
 
 	for name, plan := range batchPlan {
-		src := e.sources[name]
 		switch plan.Access {
 		case AccessAttached:
 			attachments = append(attachments, AttachInfo{
@@ -198,19 +400,21 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 
 		case AccessIndexed:
 			// Read all records into a Go hash map indexed on the join column
-			ch, err := src.Records()
+			ch, err := e.records(name, true)
 			if err != nil {
 				return fmt.Errorf("source %s: %w", name, err)
 			}
 			idx := &IndexedTable{
-				name:      name,
-				joinCol:   plan.JoinCol,
-				streamCol: plan.StreamCol,
-				records:   make(map[interface{}][]source.Record),
+				name:       name,
+				joinCols:   plan.JoinCols,
+				streamCols: plan.StreamCols,
+				records:    make(map[interface{}][]source.Record),
 			}
 			for rec := range ch {
-				key := normalizeKey(rec[plan.JoinCol])
-				if key != nil {
+				if !matchesFilters(rec, plan.Filters) {
+					continue
+				}
+				if key := indexKey(rec, plan.JoinCols); key != nil {
 					idx.records[key] = append(idx.records[key], rec)
 				}
 			}
@@ -226,7 +430,7 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 				}
 			}
 			staticTables[name] = true
-			ch, err := src.Records()
+			ch, err := e.records(name, true)
 			if err != nil {
 				if staticDB != nil {
 					staticDB.Close()
@@ -235,6 +439,7 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 			}
 			for rec := range ch {
 				if err := insertRecord(staticDB, name, rec); err != nil {
+					drain(ch)
 					staticDB.Close()
 					return fmt.Errorf("insert into %s: %w", name, err)
 				}
@@ -255,13 +460,15 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 	wm := NewWindowManager(stmt.Over, staticTables, staticDB, attachments)
 	defer wm.Close()
 
-	merged, err := mergeStreams(streamingSources)
+	merged, err := e.mergeStreams(streamingSources)
 	if err != nil {
 		return err
 	}
 
+	casts := outputCasts(stmt)
+
 	if stmt.Every > 0 {
-		return e.streamWithEvery(wm, sqlStr, merged, stmt.Every, indexedTables)
+		return e.streamWithEvery(wm, sqlStr, args, merged, stmt.Every, indexedTables, casts)
 	}
 
 	// Without EVERY: query after each insert
@@ -275,24 +482,11 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 			return fmt.Errorf("insert: %w", err)
 		}
 
-		// Populate indexed batch tables on demand
-		for _, idx := range indexedTables {
-			key := normalizeKey(tr.rec[idx.streamCol])
-			if key == nil {
-				continue
-			}
-			if win.hasKey(idx.name, key) {
-				continue
-			}
-			for _, rec := range idx.records[key] {
-				if err := insertRecord(win.DB, idx.name, rec); err != nil {
-					return fmt.Errorf("insert indexed %s: %w", idx.name, err)
-				}
-			}
-			win.markKey(idx.name, key)
+		if err := populateIndexed(win, indexedTables, tr.rec); err != nil {
+			return err
 		}
 
-		rows, err := win.DB.Query(sqlStr)
+		rows, err := win.DB.Query(sqlStr, args...)
 		if err != nil {
 			// In multi-stream mode, some tables may not exist yet
 			if isNoSuchTableErr(err) {
@@ -300,7 +494,7 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 			}
 			return fmt.Errorf("query: %w\nSQL: %s", err, sqlStr)
 		}
-		if err := e.writeRows(rows); err != nil {
+		if err := e.writeRows(rows, casts); err != nil {
 			rows.Close()
 			return err
 		}
@@ -310,7 +504,7 @@ func (e *Engine) executeStreaming(stmt *ast.SelectStatement) error {
 	return nil
 }
 
-func (e *Engine) streamWithEvery(wm *WindowManager, sqlStr string, merged <-chan taggedRecord, every time.Duration, indexedTables []*IndexedTable) error {
+func (e *Engine) streamWithEvery(wm *WindowManager, sqlStr string, args []interface{}, merged <-chan taggedRecord, every time.Duration, indexedTables []*IndexedTable, casts map[string]string) error {
 	ticker := time.NewTicker(every)
 	defer ticker.Stop()
 
@@ -323,11 +517,11 @@ func (e *Engine) streamWithEvery(wm *WindowManager, sqlStr string, merged <-chan
 				if err != nil {
 					return fmt.Errorf("get window: %w", err)
 				}
-				rows, err := win.DB.Query(sqlStr)
+				rows, err := win.DB.Query(sqlStr, args...)
 				if err != nil {
 					return fmt.Errorf("query: %w", err)
 				}
-				err = e.writeRows(rows)
+				err = e.writeRows(rows, casts)
 				rows.Close()
 				return err
 			}
@@ -340,21 +534,8 @@ func (e *Engine) streamWithEvery(wm *WindowManager, sqlStr string, merged <-chan
 				return fmt.Errorf("insert: %w", err)
 			}
 
-			// Populate indexed batch tables on demand
-			for _, idx := range indexedTables {
-				key := normalizeKey(tr.rec[idx.streamCol])
-				if key == nil {
-					continue
-				}
-				if win.hasKey(idx.name, key) {
-					continue
-				}
-				for _, rec := range idx.records[key] {
-					if err := insertRecord(win.DB, idx.name, rec); err != nil {
-						return fmt.Errorf("insert indexed %s: %w", idx.name, err)
-					}
-				}
-				win.markKey(idx.name, key)
+			if err := populateIndexed(win, indexedTables, tr.rec); err != nil {
+				return err
 			}
 
 		case <-ticker.C:
@@ -362,12 +543,12 @@ func (e *Engine) streamWithEvery(wm *WindowManager, sqlStr string, merged <-chan
 			if err != nil {
 				return fmt.Errorf("get window: %w", err)
 			}
-			rows, err := win.DB.Query(sqlStr)
+			rows, err := win.DB.Query(sqlStr, args...)
 			if err != nil {
 				// Table might not exist yet if no records inserted
 				continue
 			}
-			if err := e.writeRows(rows); err != nil {
+			if err := e.writeRows(rows, casts); err != nil {
 				rows.Close()
 				return err
 			}
@@ -376,7 +557,62 @@ func (e *Engine) streamWithEvery(wm *WindowManager, sqlStr string, merged <-chan
 	}
 }
 
-func (e *Engine) writeRows(rows *sql.Rows) error {
+// outputCasts maps output column names to BOOLEAN, JSON or TIMESTAMP types, whose
+// values SQLite returns as integers, text and epoch seconds and which must be
+// converted back for output.
+func outputCasts(stmt *ast.SelectStatement) map[string]string {
+	casts := make(map[string]string)
+	for _, col := range stmt.Columns {
+		if col.Expr == nil {
+			continue
+		}
+		typ := "TIMESTAMP"
+		if cast, ok := col.Expr.(*ast.CastExpr); ok && (cast.Type == "BOOLEAN" || cast.Type == "JSON") {
+			typ = cast.Type
+		} else if !isTimeExpr(col.Expr) {
+			continue
+		}
+		if name := columnAlias(col); name != "" {
+			casts[name] = typ
+		}
+	}
+	return casts
+}
+
+// applyCast converts a scanned SQLite value according to a BOOLEAN, JSON or
+// TIMESTAMP type. Times are written in RFC 3339.
+func applyCast(v interface{}, typ string) interface{} {
+	switch typ {
+	case "TIMESTAMP":
+		switch n := v.(type) {
+		case int64:
+			return formatEpoch(float64(n))
+		case float64:
+			return formatEpoch(n)
+		}
+	case "BOOLEAN":
+		switch n := v.(type) {
+		case int64:
+			return n != 0
+		case float64:
+			return n != 0
+		}
+	case "JSON":
+		switch s := v.(type) {
+		case string:
+			if json.Valid([]byte(s)) {
+				return json.RawMessage(s)
+			}
+		case []byte:
+			if json.Valid(s) {
+				return json.RawMessage(s)
+			}
+		}
+	}
+	return v
+}
+
+func (e *Engine) writeRows(rows *sql.Rows, casts map[string]string) error {
 	cols, err := rows.Columns()
 	if err != nil {
 		return err
@@ -392,10 +628,17 @@ func (e *Engine) writeRows(rows *sql.Rows) error {
 			return err
 		}
 
-		rec := make(map[string]interface{}, len(cols))
+		rec := make(map[string]interface{}, len(cols)+1)
 		for i, col := range cols {
+			if typ, ok := casts[col]; ok {
+				rec[col] = applyCast(vals[i], typ)
+				continue
+			}
 			rec[col] = vals[i]
 		}
+		if e.tagKey != "" {
+			rec[e.tagKey] = e.tagValue
+		}
 
 		b, err := json.Marshal(rec)
 		if err != nil {
@@ -470,6 +713,25 @@ func insertRecord(db *sql.DB, table string, rec source.Record) error {
 	return err
 }
 
+// loadedColumns returns the columns of the table records were loaded into, or
+// nil when there were none to create it.
+func loadedColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
 func sqliteType(v interface{}) string {
 	switch v.(type) {
 	case float64, float32, int, int64:
@@ -481,6 +743,72 @@ func sqliteType(v interface{}) string {
 	}
 }
 
+// populateIndexed inserts the batch rows matching a streaming record into the
+// window's copy of each indexed table, once per key.
+func populateIndexed(win *Window, indexedTables []*IndexedTable, streamRec source.Record) error {
+	for _, idx := range indexedTables {
+		key := indexKey(streamRec, idx.streamCols)
+		if key == nil {
+			continue
+		}
+		if win.hasKey(idx.name, key) {
+			continue
+		}
+		for _, rec := range idx.records[key] {
+			if err := insertRecord(win.DB, idx.name, rec); err != nil {
+				return fmt.Errorf("insert indexed %s: %w", idx.name, err)
+			}
+		}
+		win.markKey(idx.name, key)
+	}
+	return nil
+}
+
+// indexKey returns the hash key for the values of cols in rec, or nil if any of
+// them is NULL, since NULL never satisfies an equi-join. A single column is keyed
+// on its normalized value; several columns are keyed on their JSON encoding.
+func indexKey(rec source.Record, cols []string) interface{} {
+	if len(cols) == 1 {
+		return normalizeKey(rec[cols[0]])
+	}
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		v := normalizeKey(rec[col])
+		if v == nil {
+			return nil
+		}
+		vals[i] = v
+	}
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// matchesFilters reports whether rec can satisfy every column = literal filter.
+// Values whose type differs from the literal are kept and left to SQLite, whose
+// comparison rules are looser than Go's.
+func matchesFilters(rec source.Record, filters map[string]interface{}) bool {
+	for col, want := range filters {
+		got := normalizeKey(rec[col])
+		if got == nil {
+			return false
+		}
+		switch want := want.(type) {
+		case float64:
+			if f, ok := got.(float64); ok && f != want {
+				return false
+			}
+		case string:
+			if s, ok := got.(string); ok && s != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // isNoSuchTableErr returns true if the error is a SQLite "no such table" error.
 func isNoSuchTableErr(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "no such table")
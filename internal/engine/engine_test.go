@@ -315,6 +315,24 @@ func TestBatchOrderByLimit(t *testing.T) {
 	}
 }
 
+func TestBatchLimitOffset(t *testing.T) {
+	// Ages ascending: Bob(25), Diana(28), Alice(30), Charlie(35), Eve(42)
+	for _, query := range []string{
+		"SELECT name FROM users ORDER BY age LIMIT 2 OFFSET 2",
+		"SELECT name FROM users ORDER BY age LIMIT 2, 2",
+	} {
+		users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+		rows := parseAndExec(t, query, users)
+		var got []string
+		for _, r := range rows {
+			got = append(got, getString(r, "name"))
+		}
+		if fmt.Sprint(got) != "[Alice Charlie]" {
+			t.Errorf("%s: got %v", query, got)
+		}
+	}
+}
+
 func TestBatchDistinct(t *testing.T) {
 	events, err := source.NewFileSource("events", testdataPath("events.jsonl"))
 	if err != nil {
@@ -427,6 +445,19 @@ func TestBatchAggregateFunctions(t *testing.T) {
 	}
 }
 
+func TestBatchBareColumnWithMax(t *testing.T) {
+	stdin := newStaticChan("stdin",
+		source.Record{"user": "a", "latency": float64(120)},
+		source.Record{"user": "b", "latency": float64(340)},
+		source.Record{"user": "c", "latency": float64(90)},
+	)
+	// SQLite takes user from the row that holds the maximum.
+	rows := parseAndExec(t, "SELECT user, MAX(latency) worst FROM stdin", stdin)
+	if len(rows) != 1 || getString(rows[0], "user") != "b" || getFloat(rows[0], "worst") != 340 {
+		t.Errorf("got %v, want user b with 340", rows)
+	}
+}
+
 func TestBatchSparseColumns(t *testing.T) {
 	// sparse.jsonl has records with different sets of keys
 	sparse, err := source.NewFileSource("data", testdataPath("sparse.jsonl"))
@@ -464,20 +495,389 @@ func TestBatchArithmeticExpressions(t *testing.T) {
 	}
 }
 
+func TestBatchConcatAndBitwise(t *testing.T) {
+	hosts := newStaticChan("hosts",
+		source.Record{"host": "web1", "port": "80", "flags": float64(5)},
+		source.Record{"host": "web2", "port": "8080", "flags": float64(2)},
+	)
+	owners := newStaticChan("owners",
+		source.Record{"addr": "web1:80", "team": "edge"},
+		source.Record{"addr": "web2:8080", "team": "api"},
+	)
+	rows := parseAndExec(t,
+		"SELECT h.host || ':' || h.port addr, o.team, h.flags & 4 <> 0 tls FROM hosts h JOIN owners o ON h.host || ':' || h.port = o.addr ORDER BY addr",
+		hosts, owners,
+	)
+	want := []string{"web1:80 edge 1", "web2:8080 api 0"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d: %v", len(want), len(rows), rows)
+	}
+	for i, r := range rows {
+		if got := fmt.Sprintf("%s %s %v", getString(r, "addr"), getString(r, "team"), getFloat(r, "tls")); got != want[i] {
+			t.Errorf("row %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestBatchConcatNumbers(t *testing.T) {
+	// Numbers are stored as REAL, but whole ones concatenate without ".0".
+	hosts := newStaticChan("hosts",
+		source.Record{"host": "h", "port": float64(8080), "load": 0.5},
+	)
+	sel := parseQuery(t, "SELECT host || ':' || port addr, load || '/' || (port + 1) || '/' || -3 info FROM hosts")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(hosts)
+	if err := eng.Execute(sel); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"addr":"h:8080","info":"0.5/8081/-3"}` + "\n"; buf.String() != want {
+		t.Errorf("got %s, want %s", buf.String(), want)
+	}
+}
+
 func TestBatchGroupByHaving(t *testing.T) {
-	// GROUP BY with aggregate filtering via subquery-style WHERE
 	orders, _ := source.NewFileSource("orders", testdataPath("orders.jsonl"))
 	rows := parseAndExec(t,
-		"SELECT user_id, SUM(quantity) total FROM orders GROUP BY user_id ORDER BY total DESC",
+		"SELECT user_id, SUM(quantity) total FROM orders GROUP BY user_id HAVING SUM(quantity) > 2 ORDER BY total DESC",
 		orders,
 	)
-	if len(rows) == 0 {
-		t.Fatal("expected grouped rows")
+	// Totals: user 1=3, user 2=6, user 3=3, user 4=1 -> user 4 filtered out
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(rows))
 	}
 	// user_id=2: qty 1+5=6 should be largest
 	if getFloat(rows[0], "total") != 6 {
 		t.Errorf("top total: got %v, want 6", rows[0]["total"])
 	}
+	for _, r := range rows {
+		if getFloat(r, "total") <= 2 {
+			t.Errorf("HAVING should exclude total %v", r["total"])
+		}
+	}
+}
+
+func TestBatchCaseBucketing(t *testing.T) {
+	products, _ := source.NewFileSource("products", testdataPath("products.csv"))
+	rows := parseAndExec(t,
+		"SELECT CASE WHEN price < 10 THEN 'cheap' ELSE 'pricey' END tier, COUNT(*) cnt FROM products GROUP BY tier ORDER BY tier",
+		products,
+	)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 tiers, got %d", len(rows))
+	}
+	// cheap: 9.99, 4.99, 7.50; pricey: 24.99, 14.99
+	if getString(rows[0], "tier") != "cheap" || getFloat(rows[0], "cnt") != 3 {
+		t.Errorf("cheap tier: got %v", rows[0])
+	}
+	if getString(rows[1], "tier") != "pricey" || getFloat(rows[1], "cnt") != 2 {
+		t.Errorf("pricey tier: got %v", rows[1])
+	}
+
+	rows = parseAndExec(t,
+		"SELECT name, CASE category WHEN 'tools' THEN 1 ELSE 0 END is_tool FROM products WHERE id = 101",
+		newStaticChan("products", source.Record{"id": int64(101), "name": "Widget", "category": "tools"}),
+	)
+	if len(rows) != 1 || getFloat(rows[0], "is_tool") != 1 {
+		t.Errorf("simple CASE: got %v", rows)
+	}
+}
+
+func TestBatchCast(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(path, []byte("id,price,active\n1,7.9,true\n2,10,false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := source.NewFileSource("prices", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := parseAndExec(t,
+		"SELECT id, CAST(price AS INTEGER) price, active::boolean active FROM prices ORDER BY id",
+		prices,
+	)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if getFloat(rows[0], "price") != 7 || getFloat(rows[1], "price") != 10 {
+		t.Errorf("price: got %v, %v; want 7, 10", rows[0]["price"], rows[1]["price"])
+	}
+	if rows[0]["active"] != true || rows[1]["active"] != false {
+		t.Errorf("active: got %v, %v; want true, false", rows[0]["active"], rows[1]["active"])
+	}
+}
+
+func TestBatchCastLeadingZeros(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addresses.csv")
+	if err := os.WriteFile(path, []byte("id,zip,n\n1,02134,0\n2,02138,0.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	addresses, err := source.NewFileSource("addresses", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := parseAndExec(t,
+		"SELECT zip, CAST(zip AS TEXT) zip_text, zip::integer zip_num, n FROM addresses ORDER BY id",
+		addresses,
+	)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	// A leading zero keeps a value text; other numbers, 0 included, are numbers.
+	if rows[0]["zip"] != "02134" || rows[0]["zip_text"] != "02134" || getFloat(rows[0], "zip_num") != 2134 {
+		t.Errorf("got %v, want zip 02134 as text and 2134 as a number", rows[0])
+	}
+	if rows[0]["n"] != float64(0) || rows[1]["n"] != 0.5 {
+		t.Errorf("got %v and %v, want n as the numbers 0 and 0.5", rows[0], rows[1])
+	}
+}
+
+func TestBatchCastBoolean(t *testing.T) {
+	src := newStaticChan("data",
+		source.Record{"id": float64(1), "v": "T"},
+		source.Record{"id": float64(2), "v": "No"},
+		source.Record{"id": float64(3), "v": "0.5"},
+		source.Record{"id": float64(4), "v": "abc"},
+		source.Record{"id": float64(5), "v": float64(0)},
+		source.Record{"id": float64(6), "v": nil},
+	)
+	rows := parseAndExec(t, "SELECT CAST(v AS BOOLEAN) v FROM data ORDER BY id", src)
+	var got []interface{}
+	for _, row := range rows {
+		got = append(got, row["v"])
+	}
+	if want := "[true false true false false <nil>]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestBatchCastJSON(t *testing.T) {
+	src := newStaticChan("data",
+		source.Record{"id": float64(1), "payload": map[string]interface{}{"user": "alice"}, "flag": "yes"},
+	)
+	rows := parseAndExec(t, "SELECT payload::json, CAST(flag AS BOOLEAN) flag, id::integer::text id FROM data", src)
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	payload, ok := rows[0]["payload"].(map[string]interface{})
+	if !ok || payload["user"] != "alice" {
+		t.Errorf("payload: expected JSON object, got %v", rows[0]["payload"])
+	}
+	if rows[0]["flag"] != true {
+		t.Errorf("flag: got %v, want true", rows[0]["flag"])
+	}
+	if rows[0]["id"] != "1" {
+		t.Errorf("id: got %#v, want \"1\"", rows[0]["id"])
+	}
+}
+
+func TestBatchDerivedTable(t *testing.T) {
+	orders, _ := source.NewFileSource("orders", testdataPath("orders.jsonl"))
+	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+	rows := parseAndExec(t,
+		"SELECT u.name, t.total FROM (SELECT user_id, SUM(quantity) total FROM orders GROUP BY user_id) t JOIN users u ON t.user_id = u.id WHERE t.total > 2 ORDER BY t.total DESC, u.name",
+		orders, users,
+	)
+	// Totals: Alice=3, Bob=6, Charlie=3, Diana=1
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	if getString(rows[0], "name") != "Bob" || getFloat(rows[0], "total") != 6 {
+		t.Errorf("first row: got %v, want Bob/6", rows[0])
+	}
+}
+
+func TestBatchSubqueries(t *testing.T) {
+	events, _ := source.NewFileSource("events", testdataPath("events.jsonl"))
+	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+	blocked := newStaticChan("blocked", source.Record{"id": int64(2)}, source.Record{"id": int64(5)})
+
+	rows := parseAndExec(t,
+		"SELECT action, (SELECT MAX(age) FROM users) oldest FROM events WHERE user_id IN (SELECT id FROM blocked) ORDER BY ts",
+		events, users, blocked,
+	)
+	// user 2: click, logout; user 5: login
+	if len(rows) != 3 {
+		t.Fatalf("IN subquery: expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	if getString(rows[0], "action") != "click" || getFloat(rows[0], "oldest") != 42 {
+		t.Errorf("first row: got %v, want click/42", rows[0])
+	}
+}
+
+func TestBatchExistsSubquery(t *testing.T) {
+	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+	orders, _ := source.NewFileSource("orders", testdataPath("orders.jsonl"))
+	rows := parseAndExec(t,
+		"SELECT name FROM users u WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id)",
+		users, orders,
+	)
+	// Only Eve has no orders
+	if len(rows) != 1 || getString(rows[0], "name") != "Eve" {
+		t.Errorf("NOT EXISTS: expected [Eve], got %v", rows)
+	}
+}
+
+func TestBatchWithCTE(t *testing.T) {
+	orders, _ := source.NewFileSource("orders", testdataPath("orders.jsonl"))
+	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+	rows := parseAndExec(t,
+		"WITH totals AS (SELECT user_id, SUM(quantity) total FROM orders GROUP BY user_id), big AS (SELECT * FROM totals WHERE total > 2) SELECT u.name FROM big JOIN users u ON big.user_id = u.id ORDER BY u.name",
+		orders, users,
+	)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	if getString(rows[0], "name") != "Alice" || getString(rows[1], "name") != "Bob" || getString(rows[2], "name") != "Charlie" {
+		t.Errorf("expected Alice, Bob, Charlie; got %v", rows)
+	}
+}
+
+func TestBatchSetOperations(t *testing.T) {
+	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+	orders, _ := source.NewFileSource("orders", testdataPath("orders.jsonl"))
+
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		// user ids 1-5 and order user ids 1,2,1,3,4,2
+		{"SELECT id uid FROM users UNION SELECT user_id FROM orders ORDER BY uid", []float64{1, 2, 3, 4, 5}},
+		{"SELECT user_id uid FROM orders WHERE user_id = 1 UNION ALL SELECT id FROM users WHERE id = 1 ORDER BY uid", []float64{1, 1, 1}},
+		{"SELECT id uid FROM users INTERSECT SELECT user_id FROM orders WHERE quantity > 1 ORDER BY uid", []float64{1, 2, 3}},
+		{"SELECT id uid FROM users EXCEPT SELECT user_id FROM orders ORDER BY uid DESC LIMIT 1", []float64{5}},
+	}
+	for _, tt := range tests {
+		// Sources are consumed once, so each query gets fresh ones.
+		users, _ = source.NewFileSource("users", testdataPath("users.csv"))
+		orders, _ = source.NewFileSource("orders", testdataPath("orders.jsonl"))
+		rows := parseAndExec(t, tt.query, users, orders)
+		var got []float64
+		for _, r := range rows {
+			got = append(got, getFloat(r, "uid"))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestBatchRecursiveCTE(t *testing.T) {
+	employees := newStaticChan("employees",
+		source.Record{"id": float64(2), "name": "Bob", "parent_id": float64(1)},
+		source.Record{"id": float64(1), "name": "Alice", "parent_id": nil},
+		source.Record{"id": float64(3), "name": "Carol", "parent_id": float64(2)},
+		source.Record{"id": float64(4), "name": "Dan", "parent_id": float64(1)},
+	)
+	rows := parseAndExec(t,
+		`WITH RECURSIVE chain(id, name, depth) AS (
+			SELECT id, name, 0 FROM employees WHERE parent_id IS NULL
+			UNION ALL
+			SELECT e.id, e.name, c.depth + 1 FROM employees e JOIN chain c ON e.parent_id = c.id
+		)
+		SELECT name, depth FROM chain ORDER BY depth, name`,
+		employees,
+	)
+	want := []string{"Alice:0", "Bob:1", "Dan:1", "Carol:2"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d: %v", len(want), len(rows), rows)
+	}
+	for i, r := range rows {
+		if got := fmt.Sprintf("%s:%v", getString(r, "name"), getFloat(r, "depth")); got != want[i] {
+			t.Errorf("row %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestBatchWindowFunctions(t *testing.T) {
+	// Top order per user by quantity: users 1-4 have orders, ties broken by order_id.
+	orders, _ := source.NewFileSource("orders", testdataPath("orders.jsonl"))
+	rows := parseAndExec(t,
+		`SELECT user_id, order_id FROM (
+			SELECT user_id, order_id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY quantity DESC, order_id) rn FROM orders
+		) ranked WHERE rn = 1 ORDER BY user_id`,
+		orders,
+	)
+	want := []string{"1:1", "2:6", "3:4", "4:5"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d: %v", len(want), len(rows), rows)
+	}
+	for i, r := range rows {
+		if got := fmt.Sprintf("%v:%v", getFloat(r, "user_id"), getFloat(r, "order_id")); got != want[i] {
+			t.Errorf("row %d: got %s, want %s", i, got, want[i])
+		}
+	}
+
+	// Delta from the previous row and a running total
+	orders, _ = source.NewFileSource("orders", testdataPath("orders.jsonl"))
+	rows = parseAndExec(t,
+		`SELECT order_id, quantity - LAG(quantity) OVER (ORDER BY order_id) delta,
+			SUM(quantity) OVER (ORDER BY order_id ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) total
+		FROM orders ORDER BY order_id`,
+		orders,
+	)
+	if len(rows) != 6 {
+		t.Fatalf("expected 6 rows, got %d", len(rows))
+	}
+	if rows[0]["delta"] != nil {
+		t.Errorf("expected null delta for first row, got %v", rows[0]["delta"])
+	}
+	wantDelta := []float64{-1, 0, 2, -2, 4}
+	wantTotal := []float64{2, 3, 4, 7, 8, 13}
+	for i, r := range rows {
+		if i > 0 && getFloat(r, "delta") != wantDelta[i-1] {
+			t.Errorf("row %d: delta got %v, want %v", i, r["delta"], wantDelta[i-1])
+		}
+		if getFloat(r, "total") != wantTotal[i] {
+			t.Errorf("row %d: total got %v, want %v", i, r["total"], wantTotal[i])
+		}
+	}
+}
+
+func TestBatchFullOuterJoin(t *testing.T) {
+	// Reconcile two exports: rows only on one side have NULLs on the other.
+	ledger := newStaticChan("ledger",
+		source.Record{"txn": "a", "amount": float64(10)},
+		source.Record{"txn": "b", "amount": float64(20)},
+	)
+	bank := newStaticChan("bank",
+		source.Record{"txn": "b", "amount": float64(25)},
+		source.Record{"txn": "c", "amount": float64(5)},
+	)
+	rows := parseAndExec(t,
+		`SELECT COALESCE(l.txn, b.txn) txn, l.amount ledger, b.amount bank
+		FROM ledger l FULL OUTER JOIN bank b USING (txn)
+		WHERE l.amount IS NULL OR b.amount IS NULL OR l.amount != b.amount
+		ORDER BY txn`,
+		ledger, bank,
+	)
+	want := []string{"a 10 <nil>", "b 20 25", "c <nil> 5"}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d rows, got %d: %v", len(want), len(rows), rows)
+	}
+	for i, r := range rows {
+		if got := fmt.Sprintf("%s %v %v", getString(r, "txn"), r["ledger"], r["bank"]); got != want[i] {
+			t.Errorf("row %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestBatchCrossAndCommaJoins(t *testing.T) {
+	for _, query := range []string{
+		"SELECT s.size, c.color FROM sizes s CROSS JOIN colors c ORDER BY s.size, c.color",
+		"SELECT s.size, c.color FROM sizes s, colors c ORDER BY s.size, c.color",
+	} {
+		sizes := newStaticChan("sizes", source.Record{"size": "L"}, source.Record{"size": "M"})
+		colors := newStaticChan("colors", source.Record{"color": "red"}, source.Record{"color": "blue"})
+		rows := parseAndExec(t, query, sizes, colors)
+		var got []string
+		for _, r := range rows {
+			got = append(got, getString(r, "size")+"/"+getString(r, "color"))
+		}
+		if fmt.Sprint(got) != "[L/blue L/red M/blue M/red]" {
+			t.Errorf("%s: got %v", query, got)
+		}
+	}
 }
 
 func TestBatchNotIn(t *testing.T) {
@@ -1134,35 +1534,829 @@ func TestSQLiteFileExtensionDetection(t *testing.T) {
 			t.Errorf("extension %s: expected 1 row, got %d", ext, len(rows))
 		}
 	}
-}
+}
+
+func TestSQLiteAnalyzeColumns(t *testing.T) {
+	dbPath := createTestSQLiteDB(t, "customers",
+		`CREATE TABLE customers (id INTEGER, name TEXT, city TEXT)`,
+		[]string{`INSERT INTO customers VALUES (1, 'Alice', 'NYC')`},
+	)
+
+	src, _ := source.NewSQLiteSource("customers", dbPath, "")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(src)
+	err := eng.Execute(parseQuery(t, "SELECT c.name, c.country FROM customers c"))
+	if err == nil || err.Error() != `unknown column "country" in table "c" at line 1 position 16` {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSQLiteSchemaQualified(t *testing.T) {
+	// Any table of a SQLite source's database can be read as source.table.
+	dbPath := createTestSQLiteDB(t, "customers",
+		`CREATE TABLE customers (id INTEGER, name TEXT)`,
+		[]string{
+			`INSERT INTO customers VALUES (1, 'Alice')`,
+			`INSERT INTO customers VALUES (2, 'Bob')`,
+			`CREATE TABLE "order items" (customer_id INTEGER, qty INTEGER)`,
+			`INSERT INTO "order items" VALUES (1, 3)`,
+			`INSERT INTO "order items" VALUES (2, 1)`,
+			`INSERT INTO "order items" VALUES (1, 2)`,
+		},
+	)
+
+	src, err := source.NewSQLiteSource("shop", dbPath, "customers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := parseAndExec(t,
+		"SELECT customers.name, o.qty FROM shop.customers JOIN shop.[order items] o ON o.customer_id = customers.id ORDER BY o.qty",
+		src,
+	)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	for i, want := range []string{"Bob", "Alice", "Alice"} {
+		if got := getString(rows[i], "name"); got != want {
+			t.Errorf("row %d name: got %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestSQLiteDatabaseSource(t *testing.T) {
+	// A source without ?table= exposes every table and view of its database,
+	// even when none is named after the source.
+	dbPath := createTestSQLiteDB(t, "users",
+		`CREATE TABLE users (id INTEGER, name TEXT)`,
+		[]string{
+			`INSERT INTO users VALUES (1, 'Alice')`,
+			`INSERT INTO users VALUES (2, 'Bob')`,
+			`CREATE TABLE orders (user_id INTEGER, total REAL)`,
+			`INSERT INTO orders VALUES (1, 10)`,
+			`INSERT INTO orders VALUES (1, 5)`,
+			`INSERT INTO orders VALUES (2, 7)`,
+			`CREATE VIEW big_orders AS SELECT * FROM orders WHERE total > 6`,
+		},
+	)
+	newApp := func() source.Source {
+		cfg, err := source.ParseURI("app", "sqlite://"+dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := source.NewSource(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+
+	rows := parseAndExec(t,
+		"SELECT u.name, SUM(o.total) AS spent, COUNT(b.total) AS big FROM app.users u JOIN app.orders o ON o.user_id = u.id LEFT JOIN app.big_orders b ON b.user_id = u.id AND b.total = o.total GROUP BY u.name ORDER BY u.name",
+		newApp(),
+	)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if getString(rows[0], "name") != "Alice" || getFloat(rows[0], "spent") != 15 || getFloat(rows[0], "big") != 1 {
+		t.Errorf("unexpected first row %v", rows[0])
+	}
+	if getString(rows[1], "name") != "Bob" || getFloat(rows[1], "spent") != 7 || getFloat(rows[1], "big") != 1 {
+		t.Errorf("unexpected second row %v", rows[1])
+	}
+
+	// Streaming queries join against the attached database the same way.
+	stream, feed := newStreamChan("events")
+	feed <- source.Record{"user_id": float64(2), "action": "login"}
+	close(feed)
+	sel := parseQuery(t, "SELECT e.action, u.name FROM events e JOIN app.users u ON e.user_id = u.id OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(newApp())
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	rows = parseOutput(t, buf.String())
+	if len(rows) != 1 || getString(rows[0], "name") != "Bob" {
+		t.Errorf("expected Bob's login, got %v", rows)
+	}
+
+	buf.Reset()
+	eng = New(&buf)
+	eng.AddSource(newApp())
+	if err := eng.Explain(parseQuery(t, "SELECT * FROM app.users JOIN app.orders ON user_id = id")); err != nil {
+		t.Fatal(err)
+	}
+	var ex explanation
+	if err := json.Unmarshal(buf.Bytes(), &ex); err != nil {
+		t.Fatalf("unmarshal %s: %v", buf.String(), err)
+	}
+	if app := ex.Sources["app"]; app == nil || app.Access != "attached" || fmt.Sprint(app.Tables) != "[users orders]" {
+		t.Errorf("unexpected app plan %+v", app)
+	}
+	if !strings.Contains(ex.SQL, `FROM "_src_app"."users" JOIN "_src_app"."orders"`) || ex.QueryPlanError != "" {
+		t.Errorf("unexpected SQL %s (%s)", ex.SQL, ex.QueryPlanError)
+	}
+
+	// The columns of each table are known up front, and a missing table is an
+	// error rather than an empty result.
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT u.email FROM app.users u", `unknown column "email" in table "u" at line 1 position 8`},
+		{"SELECT * FROM app.nosuch", `source app: no such table: nosuch`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		eng := New(&buf)
+		eng.AddSource(newApp())
+		err := eng.Execute(parseQuery(t, tt.query))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %s", tt.query, err, tt.want)
+		}
+	}
+
+	// Schemas name their sources without regard to case, as SQLite matches
+	// table names.
+	rows = parseAndExec(t, "SELECT u.name FROM APP.users u JOIN App.orders o ON o.user_id = u.id WHERE o.total > 8", newApp())
+	if len(rows) != 1 || getString(rows[0], "name") != "Alice" {
+		t.Errorf("expected Alice, got %v", rows)
+	}
+	stream, feed = newStreamChan("events")
+	feed <- source.Record{"user_id": float64(1), "action": "login"}
+	close(feed)
+	buf.Reset()
+	eng = New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(newApp())
+	if err := eng.Execute(parseQuery(t, "SELECT e.action, u.name FROM EVENTS e JOIN App.users u ON e.user_id = u.id OVER 1h")); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if rows = parseOutput(t, buf.String()); len(rows) != 1 || getString(rows[0], "name") != "Alice" {
+		t.Errorf("expected Alice's login, got %v", rows)
+	}
+	buf.Reset()
+	eng = New(&buf)
+	eng.AddSource(newApp())
+	if err := eng.Explain(parseQuery(t, "SELECT * FROM APP.users")); err != nil {
+		t.Fatal(err)
+	}
+	ex = explanation{}
+	if err := json.Unmarshal(buf.Bytes(), &ex); err != nil {
+		t.Fatalf("unmarshal %s: %v", buf.String(), err)
+	}
+	if app := ex.Sources["app"]; app == nil || fmt.Sprint(app.Tables) != "[users]" || !strings.Contains(ex.SQL, `FROM "_src_app"."users"`) {
+		t.Errorf("unexpected plan %+v for SQL %s", app, ex.SQL)
+	}
+}
+
+func TestSchemaQualifiedErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM nosuch.users", `unknown schema "nosuch" in nosuch.users`},
+		{"SELECT * FROM users.users", `source "users" is not a SQLite database, so has no table users.users`},
+	}
+	for _, tt := range tests {
+		users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+		var buf bytes.Buffer
+		eng := New(&buf)
+		eng.AddSource(users)
+		err := eng.Execute(parseQuery(t, tt.query))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %s", tt.query, err, tt.want)
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+func TestBatchAnalyzeErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT nme FROM users", `unknown column "nme" at line 1 position 8`},
+		{"SELECT u.email FROM users u WHERE users.age > 30", `unknown table "users" (it is aliased as "u") at line 1 position 35`},
+		{"SELECT name, COUNT(*) FROM users", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 8`},
+		{"SELECT age, name FROM users GROUP BY age", `column "name" must appear in GROUP BY or be used in an aggregate function at line 1 position 13`},
+		{"SELECT name FROM users WHERE COUNT(*) > 1", `aggregate function COUNT is not allowed in WHERE at line 1 position 30`},
+	}
+	for _, tt := range tests {
+		users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+		var buf bytes.Buffer
+		eng := New(&buf)
+		eng.AddSource(users)
+		err := eng.Execute(parseQuery(t, tt.query))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %s", tt.query, err, tt.want)
+		}
+	}
+
+	// Fields of JSON lines are not known up front, so they are not checked.
+	events, _ := source.NewFileSource("events", testdataPath("events.jsonl"))
+	parseAndExec(t, "SELECT nosuchfield FROM events", events)
+
+	// Once stdin is loaded, though, a path that starts from neither a table in
+	// scope nor a field of its records is a mistyped qualifier.
+	eng := New(io.Discard)
+	eng.AddSource(newStaticChan("stdin", source.Record{"user": "a", "payload": map[string]interface{}{"level": "error"}}))
+	err := eng.Execute(parseQuery(t, "SELECT s.payload.level, x.user FROM stdin s"))
+	if want := `unknown table or column "x" at line 1 position 25`; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestBatchParams(t *testing.T) {
+	users := newStaticChan("users",
+		source.Record{"name": "O'Brien", "age": float64(40)},
+		source.Record{"name": "alice", "age": float64(30)},
+		source.Record{"name": "bob", "age": float64(20)},
+	)
+	sel := parseQuery(t, "SELECT name, :tag tag FROM users WHERE age >= :min AND name <> ? ORDER BY name")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(users)
+	eng.SetParam("min", int64(25))
+	eng.SetParam("tag", "it's")
+	eng.SetParam("1", "alice")
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	rows := parseOutput(t, buf.String())
+	if len(rows) != 1 || getString(rows[0], "name") != "O'Brien" || getString(rows[0], "tag") != "it's" {
+		t.Errorf("got %v", rows)
+	}
+	// Values are bound, not spliced into the SQL.
+	if sql := ToSQL(sel, nil); strings.Contains(sql, "alice") || !strings.Contains(sql, "?1") || !strings.Contains(sql, "?3") {
+		t.Errorf("unexpected SQL: %s", sql)
+	}
+
+	eng = New(&buf)
+	eng.AddSource(newStaticChan("users"))
+	err := eng.Execute(parseQuery(t, "SELECT name FROM users WHERE age > $1 OR name = :who"))
+	if want := "no value for parameter $1 at line 1 position 36"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	eng.SetParam("1", int64(30))
+	err = eng.Execute(parseQuery(t, "SELECT name FROM users WHERE age > ? OR name = ?"))
+	if want := "no value for parameter ? (number 2) at line 1 position 48"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	err = eng.Execute(parseQuery(t, "SELECT name FROM users WHERE age > ?1 OR name = :who"))
+	if want := "no value for parameter :who at line 1 position 49"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestStreamParams(t *testing.T) {
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"action": "login"}
+		feed <- source.Record{"action": "click"}
+		feed <- source.Record{"action": "login"}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT COUNT(*) cnt FROM events WHERE action = :action OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.SetParam("action", "login")
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	rows := parseOutput(t, buf.String())
+	if len(rows) == 0 || getFloat(rows[len(rows)-1], "cnt") != 2 {
+		t.Errorf("got %v, want a final count of 2", rows)
+	}
+}
+
+func TestBatchDistinctAndFilter(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := source.NewFileSource("orders", testdataPath("orders.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := parseAndExec(t, `SELECT COUNT(*) n,
+  COUNT(DISTINCT o.user_id) buyers,
+  COUNT(*) FILTER (WHERE u.age > 30) older,
+  COUNT(DISTINCT o.user_id) FILTER (WHERE u.age >= 30) older_buyers
+FROM orders o JOIN users u ON o.user_id = u.id`, users, orders)
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	r := rows[0]
+	if getFloat(r, "n") != 6 || getFloat(r, "buyers") != 4 || getFloat(r, "older") != 1 || getFloat(r, "older_buyers") != 2 {
+		t.Errorf("got %v, want n=6 buyers=4 older=1 older_buyers=2", r)
+	}
+}
+
+func TestStreamDistinctAndFilter(t *testing.T) {
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"user": "alice", "action": "login"}
+		feed <- source.Record{"user": "alice", "action": "click"}
+		feed <- source.Record{"user": "bob", "action": "login"}
+		feed <- source.Record{"user": "carol", "action": "click"}
+		close(feed)
+	}()
+
+	rows := parseAndExec(t, `SELECT COUNT(DISTINCT user) visitors,
+  COUNT(DISTINCT user) FILTER (WHERE action = 'login') logins
+FROM events OVER 1h`, stream)
+	if len(rows) == 0 {
+		t.Fatal("expected output")
+	}
+	last := rows[len(rows)-1]
+	if getFloat(last, "visitors") != 3 || getFloat(last, "logins") != 2 {
+		t.Errorf("got %v, want 3 visitors and 2 logins", last)
+	}
+}
+
+func TestBatchPatternOperators(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := parseAndExec(t, `SELECT name,
+  email ~ '^[a-d]\w+@' AS early,
+  name ILIKE '%E' AS ends_e,
+  name GLOB '*e' AS ends_lower_e,
+  name NOT REGEXP '[aeiou]{2}' AS no_pair
+FROM users ORDER BY id`, users)
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprintf("%s:%v%v%v%v", r["name"], r["early"], r["ends_e"], r["ends_lower_e"], r["no_pair"]))
+	}
+	if want := "[Alice:1111 Bob:1001 Charlie:1110 Diana:1000 Eve:0111]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	users, err = source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(users)
+	err = eng.Execute(parseQuery(t, "SELECT name FROM users WHERE name ~ '('"))
+	if err == nil || !strings.Contains(err.Error(), `invalid regular expression "("`) {
+		t.Errorf("expected an invalid regular expression error, got %v", err)
+	}
+}
+
+func TestStreamPatternOperators(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, feed := newStreamChan("logs")
+	go func() {
+		feed <- source.Record{"user_id": float64(1), "line": "GET /api/users 200"}
+		feed <- source.Record{"user_id": float64(2), "line": "POST /api/orders 500"}
+		feed <- source.Record{"user_id": float64(3), "line": "GET /health 503"}
+		close(feed)
+	}()
+
+	// users is in FROM, so it is loaded into the static database that each
+	// window's database attaches.
+	rows := parseAndExec(t, `SELECT COUNT(*) errors
+FROM users u JOIN logs l ON l.user_id = u.id
+WHERE u.name REGEXP '^[A-C]' AND l.line ~ ' 5\d\d$'
+OVER 1h`, users, stream)
+	if len(rows) == 0 || getFloat(rows[len(rows)-1], "errors") != 2 {
+		t.Errorf("got %v, want a final count of 2", rows)
+	}
+}
+
+func TestPatternCacheLimit(t *testing.T) {
+	c := newPatternCache(2)
+	for _, p := range []string{"a", "b", "a", "c"} {
+		if _, err := c.compile(p, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b was used least recently, so it made way for c.
+	if _, ok := c.m["b"]; ok || len(c.m) != 2 || c.order.Len() != 2 {
+		t.Errorf("expected a and c cached, got %v", c.m)
+	}
+	if _, err := c.compile("(", "("); err == nil || len(c.m) != 2 {
+		t.Errorf("expected an invalid pattern to fail uncached, got %v with %d cached", err, len(c.m))
+	}
+}
+
+func TestBatchTimestamps(t *testing.T) {
+	// 2024-05-01T12:00:00Z in each form the data may hold it, and one hour later.
+	events := newStaticChan("events",
+		source.Record{"id": float64(1), "ts": "2024-05-01T12:00:00Z"},
+		source.Record{"id": float64(2), "ts": "2024-05-01T14:00:00+02:00"},
+		source.Record{"id": float64(3), "ts": float64(1714564800)},
+		source.Record{"id": float64(4), "ts": float64(1714564800000)},
+		source.Record{"id": float64(5), "ts": "2024-05-01 13:00:00"},
+		source.Record{"id": float64(6), "ts": float64(1714568400) * 1e9},
+		source.Record{"id": float64(7), "ts": "not a time"},
+	)
+	rows := parseAndExec(t, `SELECT id,
+  ts = TIMESTAMP '2024-05-01T12:00:00Z' AS noon,
+  ts + INTERVAL '30m' > TIMESTAMP '2024-05-01T12:45:00Z' AS late,
+  ts BETWEEN DATE '2024-05-01' + 12h30m AND DATE '2024-05-02' AS afternoon,
+  ts::TIMESTAMP ts,
+  ts - 1h30m AS earlier
+FROM events ORDER BY id`, events)
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprintf("%v:%v%v%v %v %v", r["id"], r["noon"], r["late"], r["afternoon"], r["ts"], r["earlier"]))
+	}
+	want := []string{
+		"1:100 2024-05-01T12:00:00Z 2024-05-01T10:30:00Z",
+		"2:100 2024-05-01T12:00:00Z 2024-05-01T10:30:00Z",
+		"3:100 2024-05-01T12:00:00Z 2024-05-01T10:30:00Z",
+		"4:100 2024-05-01T12:00:00Z 2024-05-01T10:30:00Z",
+		"5:011 2024-05-01T13:00:00Z 2024-05-01T11:30:00Z",
+		"6:011 2024-05-01T13:00:00Z 2024-05-01T11:30:00Z",
+		"7:<nil><nil><nil> <nil> <nil>",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStreamRelativeTime(t *testing.T) {
+	now := time.Now()
+	stream, feed := newStreamChan("logs")
+	go func() {
+		feed <- source.Record{"ts": now.Add(-time.Minute).Format(time.RFC3339)}
+		feed <- source.Record{"ts": float64(now.Add(-2 * time.Minute).UnixMilli())}
+		feed <- source.Record{"ts": now.Add(-time.Hour).Format(time.RFC3339Nano)}
+		feed <- source.Record{"ts": float64(now.Add(-10 * time.Minute).Unix())}
+		close(feed)
+	}()
+
+	rows := parseAndExec(t, "SELECT COUNT(*) recent FROM logs WHERE ts > now() - INTERVAL '5m' OVER 1h", stream)
+	if len(rows) == 0 || getFloat(rows[len(rows)-1], "recent") != 2 {
+		t.Errorf("got %v, want a final count of 2", rows)
+	}
+}
+
+func TestBatchScript(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"user_id": float64(1), "action": "login"}
+		feed <- source.Record{"user_id": float64(1), "action": "click"}
+		close(feed)
+	}()
+
+	stmts, err := ast.NewParser(strings.NewReader(`
+SELECT COUNT(*) n FROM users;
+SELECT COUNT(*) n FROM users WHERE age > 30;
+SELECT u.name, COUNT(*) n FROM events e JOIN users u ON e.user_id = u.id GROUP BY u.name;
+SELECT COUNT(*) n FROM events`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.SetReplay(true)
+	eng.AddSource(users)
+	eng.AddSource(stream)
+	for i, stmt := range stmts {
+		eng.SetTag("stmt", i+1)
+		if err := eng.Execute(stmt.Select); err != nil {
+			t.Fatalf("statement %d: %v", i+1, err)
+		}
+	}
+
+	// Each source is read once and replayed to the statements after.
+	var got []string
+	for _, row := range parseOutput(t, buf.String()) {
+		got = append(got, fmt.Sprintf("%v:%v", row["stmt"], row["n"]))
+	}
+	if want := "[1:5 2:2 3:2 4:2]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestBatchInsertErrorKeepsSource(t *testing.T) {
+	// The first record cannot be stored, so the statement stops reading t
+	// after it, with more records left than the copy buffers.
+	recs := []source.Record{{"v": struct{}{}}}
+	for i := 0; i < 200; i++ {
+		recs = append(recs, source.Record{"v": float64(i)})
+	}
+	eng := New(io.Discard)
+	eng.SetReplay(true)
+	eng.AddSource(newStaticChan("t", recs...))
+	if err := eng.Execute(parseQuery(t, "SELECT COUNT(*) FROM t")); err == nil {
+		t.Fatal("expected an insert error")
+	}
+	if n := len(eng.loaded["t"]); n != len(recs) {
+		t.Errorf("kept %d records, want %d", n, len(recs))
+	}
+}
+
+func TestSingleStatementKeepsNoRecords(t *testing.T) {
+	// Without replay, the full scan, the indexed join and the streaming read
+	// each hand records on without a copy.
+	for _, query := range []string{
+		"SELECT COUNT(*) FROM users",
+		"SELECT u.name FROM events e JOIN users u ON e.user_id = u.id OVER 1h",
+		"SELECT COUNT(*) FROM users u JOIN events e ON e.user_id = u.id OVER 1h",
+	} {
+		users, err := source.NewFileSource("users", testdataPath("users.csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream, feed := newStreamChan("events")
+		feed <- source.Record{"user_id": float64(1), "action": "login"}
+		close(feed)
+
+		eng := New(io.Discard)
+		eng.AddSource(users)
+		eng.AddSource(stream)
+		if err := eng.Execute(parseQuery(t, query)); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if len(eng.loaded) != 0 {
+			t.Errorf("%s: kept the records of %d sources, want none", query, len(eng.loaded))
+		}
+	}
+}
+
+func TestBatchReadsOnlyNamedSources(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stdin is never closed, so reading it would block the query.
+	stdin, feed := newStreamChan("stdin")
+	defer close(feed)
+
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(users)
+	eng.AddSource(stdin)
+	if err := eng.Execute(parseQuery(t, "WITH stdin AS (SELECT 1 n) SELECT COUNT(*) n FROM USERS, stdin")); err != nil {
+		t.Fatal(err)
+	}
+	if rows := parseOutput(t, buf.String()); len(rows) != 1 || getFloat(rows[0], "n") != 5 {
+		t.Errorf("got %v, want a count of 5", rows)
+	}
+
+	buf.Reset()
+	if err := eng.Explain(parseQuery(t, "SELECT name FROM users")); err != nil {
+		t.Fatal(err)
+	}
+	var ex explanation
+	if err := json.Unmarshal(buf.Bytes(), &ex); err != nil {
+		t.Fatalf("unmarshal %s: %v", buf.String(), err)
+	}
+	if _, ok := ex.Sources["stdin"]; ok || ex.Sources["users"] == nil {
+		t.Errorf("expected only users in the plan, got %v", ex.Sources)
+	}
+}
+
+// ======================
+// STREAM-TO-TABLE (OVER)
+// ======================
+
+func TestStreamToTable(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"user_id": float64(1), "action": "login"}
+		feed <- source.Record{"user_id": float64(2), "action": "click"}
+		feed <- source.Record{"user_id": float64(3), "action": "purchase"}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT u.name, e.action FROM events e JOIN users u ON e.user_id = u.id OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(users)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	rows := parseOutput(t, buf.String())
+	// Without EVERY, each insert re-queries. After 3 inserts we get 1+2+3=6 output rows.
+	if len(rows) != 6 {
+		t.Fatalf("expected 6 output rows (1+2+3), got %d", len(rows))
+	}
+
+	// Verify last batch has all 3 joined rows
+	lastThree := rows[3:]
+	names := map[string]bool{}
+	for _, r := range lastThree {
+		names[getString(r, "name")] = true
+	}
+	if !names["Alice"] || !names["Bob"] || !names["Charlie"] {
+		t.Errorf("expected Alice, Bob, Charlie in last batch; got %v", names)
+	}
+}
+
+func TestStreamToTableWhere(t *testing.T) {
+	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
+
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"user_id": float64(1), "action": "login"}
+		feed <- source.Record{"user_id": float64(2), "action": "click"}
+		feed <- source.Record{"user_id": float64(5), "action": "login"}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT u.name, e.action FROM events e JOIN users u ON e.user_id = u.id WHERE u.age > 29 OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(users)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	rows := parseOutput(t, buf.String())
+	// Only Alice(30) and Eve(42) have age>29. Bob(25) filtered out.
+	// After insert 1: Alice(login) = 1 row
+	// After insert 2: Alice(login) = 1 row (Bob filtered)
+	// After insert 3: Alice(login), Eve(login) = 2 rows
+	// Total: 1 + 1 + 2 = 4
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+}
+
+func TestStreamToTableGroupBy(t *testing.T) {
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"action": "login"}
+		feed <- source.Record{"action": "click"}
+		feed <- source.Record{"action": "login"}
+		feed <- source.Record{"action": "login"}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT action, COUNT(*) cnt FROM events GROUP BY action OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	rows := parseOutput(t, buf.String())
+	// After 4 inserts with re-query each time, we get multiple outputs.
+	// Verify that the last output batch shows login=3, click=1
+	if len(rows) == 0 {
+		t.Fatal("expected output rows")
+	}
+
+	// Find the last batch (after 4th insert: 2 groups = 2 rows)
+	lastTwo := rows[len(rows)-2:]
+	counts := map[string]float64{}
+	for _, r := range lastTwo {
+		counts[getString(r, "action")] = getFloat(r, "cnt")
+	}
+	if counts["login"] != 3 {
+		t.Errorf("login count: got %v, want 3", counts["login"])
+	}
+	if counts["click"] != 1 {
+		t.Errorf("click count: got %v, want 1", counts["click"])
+	}
+}
+
+func TestStreamGroupByHaving(t *testing.T) {
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"status": float64(500)}
+		feed <- source.Record{"status": float64(200)}
+		feed <- source.Record{"status": float64(500)}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT status, COUNT(*) cnt FROM events GROUP BY status HAVING COUNT(*) > 1 OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	rows := parseOutput(t, buf.String())
+	// Only the third insert produces a group with more than one record.
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d: %v", len(rows), rows)
+	}
+	if getFloat(rows[0], "status") != 500 || getFloat(rows[0], "cnt") != 2 {
+		t.Errorf("expected status=500 cnt=2, got %v", rows[0])
+	}
+}
+
+func TestStreamDerivedTableJoin(t *testing.T) {
+	// Pre-aggregate the stream, then join the aggregate against a static lookup.
+	lookup := newStaticChan("lookup",
+		source.Record{"code": float64(200), "label": "OK"},
+		source.Record{"code": float64(500), "label": "Server Error"},
+	)
+
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"status": float64(500)}
+		feed <- source.Record{"status": float64(200)}
+		feed <- source.Record{"status": float64(500)}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT l.label, s.cnt FROM (SELECT status st, COUNT(*) cnt FROM events GROUP BY status) s JOIN lookup l ON s.st = l.code OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(lookup)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
 
-func copyFile(src, dst string) error {
-	data, err := os.ReadFile(src)
-	if err != nil {
-		return err
+	rows := parseOutput(t, buf.String())
+	// After 3 inserts: 1 + 2 + 2 = 5 rows
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %d: %v", len(rows), rows)
+	}
+	counts := map[string]float64{}
+	for _, r := range rows[3:] {
+		counts[getString(r, "label")] = getFloat(r, "cnt")
+	}
+	if counts["Server Error"] != 2 || counts["OK"] != 1 {
+		t.Errorf("last batch counts: got %v", counts)
 	}
-	return os.WriteFile(dst, data, 0644)
 }
 
-// ======================
-// STREAM-TO-TABLE (OVER)
-// ======================
+func TestStreamInSubquery(t *testing.T) {
+	blocked := newStaticChan("blocked", source.Record{"id": float64(2)})
 
-func TestStreamToTable(t *testing.T) {
-	users, err := source.NewFileSource("users", testdataPath("users.csv"))
-	if err != nil {
-		t.Fatal(err)
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"user_id": float64(1), "action": "login"}
+		feed <- source.Record{"user_id": float64(2), "action": "click"}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT action FROM events WHERE user_id IN (SELECT id FROM blocked) OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(blocked)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	rows := parseOutput(t, buf.String())
+	// First insert matches nothing; second returns the blocked user's click.
+	if len(rows) != 1 || getString(rows[0], "action") != "click" {
+		t.Errorf("expected [click], got %v", rows)
 	}
+}
+
+func TestStreamWithCTE(t *testing.T) {
+	users := newStaticChan("users",
+		source.Record{"id": float64(1), "name": "Alice"},
+		source.Record{"id": float64(2), "name": "Bob"},
+	)
 
 	stream, feed := newStreamChan("events")
 	go func() {
 		feed <- source.Record{"user_id": float64(1), "action": "login"}
 		feed <- source.Record{"user_id": float64(2), "action": "click"}
-		feed <- source.Record{"user_id": float64(3), "action": "purchase"}
 		close(feed)
 	}()
 
-	sel := parseQuery(t, "SELECT u.name, e.action FROM events e JOIN users u ON e.user_id = u.id OVER 1h")
+	sel := parseQuery(t, "WITH logins AS (SELECT user_id FROM events WHERE action = 'login') SELECT u.name FROM logins l JOIN users u ON l.user_id = u.id OVER 1h")
 	var buf bytes.Buffer
 	eng := New(&buf)
 	eng.AddSource(stream)
@@ -1173,65 +2367,82 @@ func TestStreamToTable(t *testing.T) {
 	}
 
 	rows := parseOutput(t, buf.String())
-	// Without EVERY, each insert re-queries. After 3 inserts we get 1+2+3=6 output rows.
-	if len(rows) != 6 {
-		t.Fatalf("expected 6 output rows (1+2+3), got %d", len(rows))
+	// One login, re-reported after the second insert
+	if len(rows) != 2 || getString(rows[0], "name") != "Alice" || getString(rows[1], "name") != "Alice" {
+		t.Errorf("expected Alice twice, got %v", rows)
 	}
+}
 
-	// Verify last batch has all 3 joined rows
-	lastThree := rows[3:]
-	names := map[string]bool{}
-	for _, r := range lastThree {
-		names[getString(r, "name")] = true
+func TestStreamCompound(t *testing.T) {
+	// OVER applies to the whole compound: both members read the same window.
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"app": "a", "level": "error", "msg": "boom"}
+		feed <- source.Record{"app": "b", "level": "info", "msg": "ok"}
+		feed <- source.Record{"app": "b", "level": "error", "msg": "bang"}
+		close(feed)
+	}()
+
+	sel := parseQuery(t, "SELECT msg FROM events WHERE app = 'a' AND level = 'error' UNION ALL SELECT msg FROM events WHERE app = 'b' AND level = 'error' ORDER BY msg OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
 	}
-	if !names["Alice"] || !names["Bob"] || !names["Charlie"] {
-		t.Errorf("expected Alice, Bob, Charlie in last batch; got %v", names)
+
+	rows := parseOutput(t, buf.String())
+	// After each insert: [boom], [boom], [bang, boom]
+	var got []string
+	for _, r := range rows {
+		got = append(got, getString(r, "msg"))
+	}
+	if fmt.Sprint(got) != "[boom boom bang boom]" {
+		t.Errorf("got %v", got)
 	}
 }
 
-func TestStreamToTableWhere(t *testing.T) {
-	users, _ := source.NewFileSource("users", testdataPath("users.csv"))
-
+func TestStreamLimitBeforeOver(t *testing.T) {
+	// LIMIT applies to each emission, not to the stream as a whole.
 	stream, feed := newStreamChan("events")
 	go func() {
-		feed <- source.Record{"user_id": float64(1), "action": "login"}
-		feed <- source.Record{"user_id": float64(2), "action": "click"}
-		feed <- source.Record{"user_id": float64(5), "action": "login"}
+		feed <- source.Record{"status": float64(500)}
+		feed <- source.Record{"status": float64(200)}
+		feed <- source.Record{"status": float64(404)}
 		close(feed)
 	}()
 
-	sel := parseQuery(t, "SELECT u.name, e.action FROM events e JOIN users u ON e.user_id = u.id WHERE u.age > 29 OVER 1h")
+	sel := parseQuery(t, "SELECT status FROM events ORDER BY status LIMIT 1 OFFSET 1 OVER 1h")
 	var buf bytes.Buffer
 	eng := New(&buf)
 	eng.AddSource(stream)
-	eng.AddSource(users)
 
 	if err := eng.Execute(sel); err != nil {
 		t.Fatalf("execute: %v", err)
 	}
 
 	rows := parseOutput(t, buf.String())
-	// Only Alice(30) and Eve(42) have age>29. Bob(25) filtered out.
-	// After insert 1: Alice(login) = 1 row
-	// After insert 2: Alice(login) = 1 row (Bob filtered)
-	// After insert 3: Alice(login), Eve(login) = 2 rows
-	// Total: 1 + 1 + 2 = 4
-	if len(rows) != 4 {
-		t.Fatalf("expected 4 rows, got %d", len(rows))
+	// After each insert: [500] skipped, [200 500] -> 500, [200 404 500] -> 404
+	var got []float64
+	for _, r := range rows {
+		got = append(got, getFloat(r, "status"))
+	}
+	if fmt.Sprint(got) != "[500 404]" {
+		t.Errorf("got %v", got)
 	}
 }
 
-func TestStreamToTableGroupBy(t *testing.T) {
+func TestStreamWindowFunction(t *testing.T) {
+	// A window function inside an OVER window sees only that window's records.
 	stream, feed := newStreamChan("events")
 	go func() {
-		feed <- source.Record{"action": "login"}
-		feed <- source.Record{"action": "click"}
-		feed <- source.Record{"action": "login"}
-		feed <- source.Record{"action": "login"}
+		feed <- source.Record{"seq": float64(1), "latency": float64(100)}
+		feed <- source.Record{"seq": float64(2), "latency": float64(130)}
 		close(feed)
 	}()
 
-	sel := parseQuery(t, "SELECT action, COUNT(*) cnt FROM events GROUP BY action OVER 1h")
+	sel := parseQuery(t, "SELECT seq, latency - LAG(latency) OVER (ORDER BY seq) delta FROM events ORDER BY seq OVER 1h")
 	var buf bytes.Buffer
 	eng := New(&buf)
 	eng.AddSource(stream)
@@ -1241,23 +2452,51 @@ func TestStreamToTableGroupBy(t *testing.T) {
 	}
 
 	rows := parseOutput(t, buf.String())
-	// After 4 inserts with re-query each time, we get multiple outputs.
-	// Verify that the last output batch shows login=3, click=1
-	if len(rows) == 0 {
-		t.Fatal("expected output rows")
+	// After each insert: [1], [1, 2]
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	if rows[0]["delta"] != nil || rows[1]["delta"] != nil {
+		t.Errorf("expected null delta for first record, got %v", rows[:2])
+	}
+	if getFloat(rows[2], "delta") != 30 {
+		t.Errorf("expected delta 30, got %v", rows[2])
 	}
+}
 
-	// Find the last batch (after 4th insert: 2 groups = 2 rows)
-	lastTwo := rows[len(rows)-2:]
-	counts := map[string]float64{}
-	for _, r := range lastTwo {
-		counts[getString(r, "action")] = getFloat(r, "cnt")
+func TestStreamJSONPaths(t *testing.T) {
+	users := newStaticChan("users",
+		source.Record{"id": float64(7), "name": "Alice"},
+		source.Record{"id": float64(8), "name": "Bob"},
+	)
+
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"payload": map[string]interface{}{"user": map[string]interface{}{"id": float64(7)}, "level": "error"}, "tags": []interface{}{"db", "slow"}}
+		feed <- source.Record{"payload": map[string]interface{}{"user": map[string]interface{}{"id": float64(8)}, "level": "info"}, "tags": []interface{}{"web"}}
+		feed <- source.Record{"payload": map[string]interface{}{"user": map[string]interface{}{"id": float64(7)}, "level": "error"}, "tags": []interface{}{"web"}}
+		close(feed)
+	}()
+
+	sel := parseQuery(t,
+		"SELECT u.name, e.tags[0] tag, COUNT(*) cnt FROM events e JOIN users u ON e.payload.user.id = u.id WHERE e.payload['level'] = 'error' GROUP BY u.name, e.tags[0] ORDER BY tag OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(users)
+	eng.AddSource(stream)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
 	}
-	if counts["login"] != 3 {
-		t.Errorf("login count: got %v, want 3", counts["login"])
+
+	rows := parseOutput(t, buf.String())
+	// After each insert: [db], [db], [db, web]
+	var got []string
+	for _, r := range rows {
+		got = append(got, fmt.Sprintf("%s/%s/%v", getString(r, "name"), getString(r, "tag"), getFloat(r, "cnt")))
 	}
-	if counts["click"] != 1 {
-		t.Errorf("click count: got %v, want 1", counts["click"])
+	if want := "[Alice/db/1 Alice/db/1 Alice/db/1 Alice/web/1]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
 	}
 }
 
@@ -1790,6 +3029,19 @@ func TestBatchNestedJSON(t *testing.T) {
 	}
 }
 
+func TestBatchJSONQuotedKeys(t *testing.T) {
+	src := newStaticChan("data",
+		source.Record{"payload": map[string]interface{}{`say "hi"`: "hello", `C:\dir`: "root", "a.b": float64(1)}},
+	)
+	rows := parseAndExec(t, `SELECT payload['say "hi"'] greeting, payload['C:\dir'] dir, payload['a.b'] ab FROM data`, src)
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	if rows[0]["greeting"] != "hello" || rows[0]["dir"] != "root" || getFloat(rows[0], "ab") != 1 {
+		t.Errorf("unexpected row %v", rows[0])
+	}
+}
+
 func TestBatchArrayJSON(t *testing.T) {
 	src := newStaticChan("data",
 		source.Record{
@@ -2258,11 +3510,11 @@ func TestAccessPatternAnalyzeBatchAccess(t *testing.T) {
 		t.Errorf("users: expected AccessIndexed, got %+v", plan["users"])
 	}
 	if plan["users"] != nil {
-		if plan["users"].JoinCol != "id" {
-			t.Errorf("users join col: got %s, want id", plan["users"].JoinCol)
+		if fmt.Sprint(plan["users"].JoinCols) != "[id]" {
+			t.Errorf("users join cols: got %v, want [id]", plan["users"].JoinCols)
 		}
-		if plan["users"].StreamCol != "user_id" {
-			t.Errorf("users stream col: got %s, want user_id", plan["users"].StreamCol)
+		if fmt.Sprint(plan["users"].StreamCols) != "[user_id]" {
+			t.Errorf("users stream cols: got %v, want [user_id]", plan["users"].StreamCols)
 		}
 	}
 }
@@ -2287,6 +3539,157 @@ func TestAccessPatternFullScanForBatchInFROM(t *testing.T) {
 	}
 }
 
+func TestAccessPatternSubquery(t *testing.T) {
+	// A batch source joined to a stream inside a derived table is still indexed;
+	// a batch source joined to a derived table is not, since the derived table's
+	// columns are not fields of the streaming records.
+	users := newStaticChan("users", source.Record{"id": float64(1), "name": "Alice"})
+	lookup := newStaticChan("lookup", source.Record{"code": "login", "label": "Login"})
+	streamSrc, _ := newStreamChan("events")
+
+	sources := map[string]source.Source{
+		"users":  users,
+		"lookup": lookup,
+		"events": streamSrc,
+	}
+
+	sel := parseQuery(t, "SELECT t.name, l.label FROM (SELECT u.name, e.action act FROM events e JOIN users u ON e.user_id = u.id) t JOIN lookup l ON t.act = l.code OVER 1h")
+	plan := AnalyzeBatchAccess(sel, sources)
+
+	if plan["users"] == nil || plan["users"].Access != AccessIndexed {
+		t.Errorf("users in subquery join: expected AccessIndexed, got %+v", plan["users"])
+	}
+	if plan["lookup"] == nil || plan["lookup"].Access != AccessFullScan {
+		t.Errorf("lookup joined to derived table: expected AccessFullScan, got %+v", plan["lookup"])
+	}
+
+	// A CTE named like a source does not count as a use of that source.
+	sel = parseQuery(t, "WITH lookup AS (SELECT u.name FROM events e JOIN users u ON e.user_id = u.id) SELECT * FROM lookup OVER 1h")
+	plan = AnalyzeBatchAccess(sel, sources)
+	if plan["users"] == nil || plan["users"].Access != AccessIndexed {
+		t.Errorf("users in CTE join: expected AccessIndexed, got %+v", plan["users"])
+	}
+	sel = parseQuery(t, "WITH Users AS (SELECT code FROM lookup) SELECT * FROM events e JOIN users u ON e.user_id = u.code OVER 1h")
+	plan = AnalyzeBatchAccess(sel, sources)
+	if plan["users"] == nil || plan["users"].Access != AccessFullScan {
+		t.Errorf("join to CTE Users: expected users unused and AccessFullScan, got %+v", plan["users"])
+	}
+
+	// A source that only appears in an expression subquery is scanned in full.
+	sel = parseQuery(t, "SELECT e.action FROM events e WHERE e.action IN (SELECT code FROM lookup) AND EXISTS (SELECT 1 FROM users u JOIN events x ON x.user_id = u.id) OVER 1h")
+	plan = AnalyzeBatchAccess(sel, sources)
+	if plan["lookup"] == nil || plan["lookup"].Access != AccessFullScan {
+		t.Errorf("lookup in IN subquery: expected AccessFullScan, got %+v", plan["lookup"])
+	}
+	if plan["users"] == nil || plan["users"].Access != AccessFullScan {
+		t.Errorf("users in EXISTS FROM: expected AccessFullScan, got %+v", plan["users"])
+	}
+}
+
+func TestAccessPatternJoinTypes(t *testing.T) {
+	users := newStaticChan("users", source.Record{"user_id": float64(1), "name": "Alice"})
+	lookup := newStaticChan("lookup", source.Record{"code": "login", "label": "Login"})
+	streamSrc, _ := newStreamChan("events")
+
+	sources := map[string]source.Source{
+		"users":  users,
+		"lookup": lookup,
+		"events": streamSrc,
+	}
+
+	tests := []struct {
+		query  string
+		access BatchAccess
+	}{
+		// USING against a stream reads the column from the streaming records
+		{"SELECT * FROM events JOIN users USING (user_id) OVER 1h", AccessIndexed},
+		{"SELECT * FROM events LEFT OUTER JOIN users u USING (user_id) OVER 1h", AccessIndexed},
+		{"SELECT * FROM events e INNER JOIN users u ON e.user_id = u.user_id OVER 1h", AccessIndexed},
+		// The column could come from lookup, which is not a stream
+		{"SELECT * FROM events e JOIN lookup l ON e.action = l.code JOIN users USING (user_id) OVER 1h", AccessFullScan},
+		// RIGHT and FULL joins keep unmatched users rows, so all of them are needed
+		{"SELECT * FROM events e RIGHT JOIN users u ON e.user_id = u.user_id OVER 1h", AccessFullScan},
+		{"SELECT * FROM events e FULL OUTER JOIN users u USING (user_id) OVER 1h", AccessFullScan},
+		{"SELECT * FROM events e CROSS JOIN users u OVER 1h", AccessFullScan},
+		{"SELECT * FROM events e, users u WHERE e.user_id = u.user_id OVER 1h", AccessFullScan},
+	}
+	for _, tt := range tests {
+		plan := AnalyzeBatchAccess(parseQuery(t, tt.query), sources)
+		if plan["users"] == nil || plan["users"].Access != tt.access {
+			t.Errorf("%s: expected access %v, got %+v", tt.query, tt.access, plan["users"])
+			continue
+		}
+		if tt.access == AccessIndexed && (fmt.Sprint(plan["users"].JoinCols) != "[user_id]" || fmt.Sprint(plan["users"].StreamCols) != "[user_id]") {
+			t.Errorf("%s: expected user_id join columns, got %+v", tt.query, plan["users"])
+		}
+	}
+}
+
+func TestAccessPatternCompositeKey(t *testing.T) {
+	accounts := newStaticChan("accounts")
+	streamSrc, _ := newStreamChan("events")
+	sources := map[string]source.Source{"accounts": accounts, "events": streamSrc}
+
+	sel := parseQuery(t, "SELECT * FROM events e JOIN accounts a ON e.tenant_id = a.tenant_id AND a.id = e.account_id AND a.status = 'active' AND 1 = a.tier AND a.credit > e.amount OVER 1h")
+	plan := AnalyzeBatchAccess(sel, sources)["accounts"]
+	if plan == nil || plan.Access != AccessIndexed {
+		t.Fatalf("expected AccessIndexed, got %+v", plan)
+	}
+	if fmt.Sprint(plan.JoinCols) != "[tenant_id id]" || fmt.Sprint(plan.StreamCols) != "[tenant_id account_id]" {
+		t.Errorf("unexpected key columns: %v / %v", plan.JoinCols, plan.StreamCols)
+	}
+	if fmt.Sprint(plan.Filters) != "map[status:active tier:1]" {
+		t.Errorf("unexpected filters: %v", plan.Filters)
+	}
+	if len(plan.Residual) != 1 {
+		t.Errorf("expected 1 residual predicate, got %d", len(plan.Residual))
+	}
+
+	// Without any batch = stream conjunct there is no key to index on.
+	sel = parseQuery(t, "SELECT * FROM events e JOIN accounts a ON a.status = 'active' AND a.credit > e.amount OVER 1h")
+	if plan := AnalyzeBatchAccess(sel, sources)["accounts"]; plan == nil || plan.Access != AccessFullScan {
+		t.Errorf("expected AccessFullScan, got %+v", plan)
+	}
+}
+
+func TestAccessPatternCompositeKeyLookup(t *testing.T) {
+	accounts := newStaticChan("accounts",
+		source.Record{"tenant_id": float64(1), "id": float64(10), "name": "acme-main", "status": "active", "credit": float64(100)},
+		source.Record{"tenant_id": float64(2), "id": float64(10), "name": "globex-main", "status": "active", "credit": float64(100)},
+		source.Record{"tenant_id": float64(1), "id": float64(11), "name": "acme-old", "status": "closed", "credit": float64(100)},
+	)
+
+	stream, feed := newStreamChan("events")
+	go func() {
+		feed <- source.Record{"tenant_id": float64(2), "account_id": float64(10), "amount": float64(50)}
+		feed <- source.Record{"tenant_id": float64(1), "account_id": float64(11), "amount": float64(50)}
+		feed <- source.Record{"tenant_id": float64(1), "account_id": float64(10), "amount": float64(500)}
+		close(feed)
+	}()
+
+	sel := parseQuery(t,
+		"SELECT a.name, e.amount FROM events e JOIN accounts a ON e.tenant_id = a.tenant_id AND e.account_id = a.id AND a.status = 'active' AND e.amount <= a.credit OVER 1h")
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(stream)
+	eng.AddSource(accounts)
+
+	if err := eng.Execute(sel); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	// The closed account is filtered out before indexing, and the third event
+	// matches acme-main on its key but fails the residual credit check.
+	rows := parseOutput(t, buf.String())
+	var got []string
+	for _, r := range rows {
+		got = append(got, getString(r, "name"))
+	}
+	if fmt.Sprint(got) != "[globex-main globex-main globex-main]" {
+		t.Errorf("got %v", got)
+	}
+}
+
 // ================================
 // HELPERS
 // ================================
@@ -2304,3 +3707,74 @@ func scanWithTimeout(scanner *bufio.Scanner, timeout time.Duration) bool {
 		return false
 	}
 }
+
+func TestExplainSourceCase(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, feed := newStreamChan("events")
+	defer close(feed)
+
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(users)
+	eng.AddSource(stream)
+	if err := eng.Explain(parseQuery(t, "SELECT e.action, u.name FROM Events e JOIN USERS u ON u.id = e.user_id OVER 5s")); err != nil {
+		t.Fatal(err)
+	}
+	var ex explanation
+	if err := json.Unmarshal(buf.Bytes(), &ex); err != nil {
+		t.Fatalf("unmarshal %s: %v", buf.String(), err)
+	}
+	// USERS is the source users, so it is looked up by its join column.
+	if u := ex.Sources["users"]; u == nil || u.Access != "indexed" {
+		t.Errorf("unexpected users plan %+v", u)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	users, err := source.NewFileSource("users", testdataPath("users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, feed := newStreamChan("events")
+	defer close(feed)
+
+	stmts, err := ast.NewParser(strings.NewReader(
+		"EXPLAIN SELECT e.action, u.name FROM events e JOIN users u ON u.id = e.user_id OVER 5s")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stmts[0].Explain {
+		t.Fatal("expected Explain to be set")
+	}
+	var buf bytes.Buffer
+	eng := New(&buf)
+	eng.AddSource(users)
+	eng.AddSource(stream)
+	if err := eng.Explain(stmts[0].Select); err != nil {
+		t.Fatal(err)
+	}
+
+	var ex explanation
+	if err := json.Unmarshal(buf.Bytes(), &ex); err != nil {
+		t.Fatalf("unmarshal %s: %v", buf.String(), err)
+	}
+	if ex.Mode != "streaming" || ex.Window == nil || ex.Window.Over != "5s" {
+		t.Errorf("unexpected mode %q and window %+v", ex.Mode, ex.Window)
+	}
+	u := ex.Sources["users"]
+	if u == nil || u.Access != "indexed" || fmt.Sprint(u.JoinColumns) != "[id]" || fmt.Sprint(u.StreamColumns) != "[user_id]" {
+		t.Errorf("unexpected users plan %+v", u)
+	}
+	if e := ex.Sources["events"]; e == nil || e.Access != "window" {
+		t.Errorf("unexpected events plan %+v", e)
+	}
+	if !strings.Contains(ex.SQL, `JOIN "users" "u"`) {
+		t.Errorf("unexpected SQL %s", ex.SQL)
+	}
+	if ex.QueryPlanError != "" || len(ex.QueryPlan) == 0 {
+		t.Errorf("expected a query plan, got %v (%s)", ex.QueryPlan, ex.QueryPlanError)
+	}
+}
@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kevin-cantwell/csql/internal/ast"
+	"github.com/kevin-cantwell/csql/internal/source"
+)
+
+// explanation is the document Explain writes.
+type explanation struct {
+	Mode    string                 `json:"mode"` // "batch" or "streaming"
+	Window  *windowPlan            `json:"window,omitempty"`
+	Sources map[string]*sourcePlan `json:"sources"`
+	SQL     string                 `json:"sql"`
+	// QueryPlan is SQLite's EXPLAIN QUERY PLAN for SQL, run against empty
+	// tables. QueryPlanError is set instead when SQLite could not plan it.
+	QueryPlan      []queryPlanStep `json:"query_plan,omitempty"`
+	QueryPlanError string          `json:"query_plan_error,omitempty"`
+}
+
+type windowPlan struct {
+	Over  string `json:"over"`
+	Every string `json:"every,omitempty"`
+}
+
+// sourcePlan describes how a source is read. Access is that of its
+// BatchTablePlan, or "window" for a streaming source whose records are
+// inserted into each window as they arrive.
+type sourcePlan struct {
+	Type          string                 `json:"type"` // "static" or "streaming"
+	Access        string                 `json:"access"`
+	Schema        string                 `json:"schema,omitempty"`
+	Table         string                 `json:"table"`
+	Tables        []string               `json:"tables,omitempty"` // tables of its database read as name.table
+	JoinColumns   []string               `json:"join_columns,omitempty"`
+	StreamColumns []string               `json:"stream_columns,omitempty"`
+	Filters       map[string]interface{} `json:"filters,omitempty"`
+	Residual      []string               `json:"residual,omitempty"`
+	AttachPath    string                 `json:"attach_path,omitempty"`
+}
+
+type queryPlanStep struct {
+	ID     int    `json:"id"`
+	Parent int    `json:"parent"`
+	Detail string `json:"detail"`
+}
+
+// Explain writes a JSON document describing how stmt would run, without
+// reading any source: how each source is accessed, the SQL sent to SQLite,
+// and SQLite's plan for it.
+func (e *Engine) Explain(stmt *ast.SelectStatement) error {
+	e.sourceNames(stmt)
+	schemas, err := e.schemas(stmt)
+	if err != nil {
+		return err
+	}
+	if err := ast.Analyze(stmt, schemas); err != nil {
+		return err
+	}
+
+	ex := &explanation{Mode: "batch", Sources: make(map[string]*sourcePlan)}
+	var plans map[string]*BatchTablePlan
+	if stmt.Over > 0 {
+		ex.Mode = "streaming"
+		ex.Window = &windowPlan{Over: stmt.Over.String()}
+		if stmt.Every > 0 {
+			ex.Window.Every = stmt.Every.String()
+		}
+		plans = AnalyzeBatchAccess(stmt, e.sources)
+	} else {
+		plans = e.batchPlans(stmt)
+	}
+	ex.SQL = ToSQLWithPlans(stmt, BuildTableSchemas(plans), plans)
+
+	for name, src := range e.sources {
+		sp := &sourcePlan{Type: "static", Table: name}
+		if src.Type() == source.Streaming {
+			sp.Type = "streaming"
+		}
+		plan, ok := plans[name]
+		if !ok && stmt.Over == 0 {
+			// A batch query reads only the sources it names.
+			continue
+		}
+		if !ok {
+			sp.Access = "window"
+			ex.Sources[name] = sp
+			continue
+		}
+		sp.Access = plan.Access.String()
+		sp.Schema = plan.Schema
+		sp.Table = plan.SQLTable
+		sp.JoinColumns = plan.JoinCols
+		sp.StreamColumns = plan.StreamCols
+		sp.Filters = plan.Filters
+		for _, expr := range plan.Residual {
+			sp.Residual = append(sp.Residual, ast.FormatExpr(expr))
+		}
+		sp.AttachPath = plan.AttachPath
+		ex.Sources[name] = sp
+	}
+	for _, ref := range qualifiedTables(stmt) {
+		sp := ex.Sources[ref.Schema]
+		sp.Tables = append(sp.Tables, ref.Name)
+	}
+
+	steps, err := e.queryPlan(stmt, plans, schemas, ex.SQL)
+	if err != nil {
+		ex.QueryPlanError = err.Error()
+	}
+	ex.QueryPlan = steps
+
+	enc := json.NewEncoder(e.output)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ex)
+}
+
+// queryPlan runs EXPLAIN QUERY PLAN for sqlStr in a database laid out as the
+// query's own would be, with SQLite sources attached and an empty table for
+// every other source.
+func (e *Engine) queryPlan(stmt *ast.SelectStatement, plans map[string]*BatchTablePlan, schemas map[string][]string, sqlStr string) ([]queryPlanStep, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	defer db.Close()
+	// Attached databases belong to a connection, so keep to one.
+	db.SetMaxOpenConns(1)
+
+	columns := sourceColumns(stmt, schemas)
+	attachedStatic := false
+	for name := range e.sources {
+		table := quoteIdent(name)
+		if plan, ok := plans[name]; ok {
+			switch {
+			case plan.Access == AccessAttached:
+				if _, err := db.Exec(fmt.Sprintf("ATTACH DATABASE %s AS %s", quoteLiteral(plan.AttachPath), quoteIdent(plan.Schema))); err != nil {
+					return nil, fmt.Errorf("attach %s: %w", name, err)
+				}
+				continue
+			case plan.Schema != "":
+				if !attachedStatic {
+					if _, err := db.Exec("ATTACH DATABASE ':memory:' AS " + quoteIdent(plan.Schema)); err != nil {
+						return nil, err
+					}
+					attachedStatic = true
+				}
+				table = quoteIdent(plan.Schema) + "." + quoteIdent(plan.SQLTable)
+			}
+		}
+
+		cols := columns[name]
+		if len(cols) == 0 {
+			// A table needs a column, even one the query never reads.
+			cols = []string{"_"}
+		}
+		defs := make([]string, len(cols))
+		for i, col := range cols {
+			defs[i] = quoteIdent(col)
+		}
+		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(defs, ", "))); err != nil {
+			return nil, fmt.Errorf("create table %s: %w", name, err)
+		}
+	}
+
+	// Parameters are left unbound, as NULL.
+	var args []interface{}
+	if params := stmt.Params(); len(params) > 0 {
+		args = make([]interface{}, params[len(params)-1].Index)
+	}
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []queryPlanStep
+	for rows.Next() {
+		var step queryPlanStep
+		var notUsed int
+		if err := rows.Scan(&step.ID, &step.Parent, &notUsed, &step.Detail); err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+// sourceColumns returns the columns of each source that stmt reads, for
+// building empty tables to plan it against. Sources in known keep the columns
+// listed there. For the rest, the columns are guessed from the query: a
+// qualified column belongs to the table its qualifier names, and an
+// unqualified one to the first table of its SELECT not known to lack it.
+func sourceColumns(stmt *ast.SelectStatement, known map[string][]string) map[string][]string {
+	cols := &columnGuesses{known: known, seen: make(map[string]bool), cols: make(map[string][]string)}
+	for name, list := range known {
+		cols.cols[name] = list
+	}
+	ast.Walk(columnScope{g: cols}, stmt)
+	return cols.cols
+}
+
+type columnGuesses struct {
+	known map[string][]string
+	seen  map[string]bool // "table.column" pairs already added
+	cols  map[string][]string
+}
+
+func (g *columnGuesses) add(table, col string) {
+	if _, ok := g.known[table]; ok || table == "" || g.seen[table+"."+col] {
+		return
+	}
+	g.seen[table+"."+col] = true
+	g.cols[table] = append(g.cols[table], col)
+}
+
+// knownHas reports whether table's columns are known and include col.
+func (g *columnGuesses) knownHas(table, col string) bool {
+	for _, c := range g.known[table] {
+		if strings.EqualFold(c, col) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnScope visits a SELECT, whose own tables are in tables, and in which
+// aliases maps the names and aliases in scope to the tables they refer to.
+type columnScope struct {
+	g       *columnGuesses
+	aliases map[string]string
+	tables  []string
+}
+
+func (v columnScope) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.SelectStatement:
+		aliases := make(map[string]string, len(v.aliases))
+		for alias, name := range v.aliases {
+			aliases[alias] = name
+		}
+		v.aliases = aliases
+		v.tables = nil
+		for alias, name := range selectAliases(n) {
+			v.aliases[alias] = name
+		}
+		if n.From != nil {
+			v.tables = append(v.tables, n.From.Table.QualifiedName())
+		}
+		for _, j := range n.Joins {
+			v.tables = append(v.tables, j.Table.QualifiedName())
+		}
+	case *ast.JoinClause:
+		for _, col := range n.Using {
+			for _, table := range v.tables {
+				v.g.add(table, col)
+			}
+		}
+	case *ast.ColumnRef:
+		if n.Column == "*" {
+			break
+		}
+		if n.Table != "" {
+			v.g.add(v.aliases[n.Table], n.Column)
+			break
+		}
+		for _, table := range v.tables {
+			if v.g.knownHas(table, n.Column) {
+				return v
+			}
+		}
+		for _, table := range v.tables {
+			if _, ok := v.g.known[table]; !ok && table != "" {
+				v.g.add(table, n.Column)
+				break
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"container/list"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"modernc.org/sqlite"
+)
+
+// ilikeFunc is the SQLite function ILIKE is translated to, called as
+// ilikeFunc(pattern, value) like SQLite's own like().
+const ilikeFunc = "csql_ilike"
+
+// The driver adds these functions to every connection it opens, so the batch,
+// window and static databases all have them. SQLite calls regexp(pattern,
+// value) for "value REGEXP pattern".
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return matchPattern(args, func(pattern string) (*regexp.Regexp, error) {
+			return patterns.compile(pattern, pattern)
+		})
+	})
+	sqlite.MustRegisterDeterministicScalarFunction(ilikeFunc, 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return matchPattern(args, func(pattern string) (*regexp.Regexp, error) {
+			return patterns.compile("ILIKE "+pattern, likeToRegexp(pattern))
+		})
+	})
+}
+
+// matchPattern reports whether the value in args[1] matches the pattern in
+// args[0], as 1 or 0, or NULL if either is NULL.
+func matchPattern(args []driver.Value, compile func(string) (*regexp.Regexp, error)) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+	re, err := compile(sqlText(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if re.MatchString(sqlText(args[1])) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+// sqlText converts a SQLite value to text the way SQLite does for string
+// operations.
+func sqlText(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', 15, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// likeToRegexp translates a LIKE pattern, in which % matches any run of
+// characters and _ any one character, to a case-insensitive regular
+// expression matching the whole value. Case folding covers all of Unicode, not
+// just the ASCII letters SQLite's LIKE folds.
+func likeToRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// patternCache holds the regular expressions compiled most recently, so a
+// pattern is compiled once rather than once per row. The SQLite functions are
+// registered with the driver rather than an Engine, so one cache serves every
+// Engine; a compiled pattern does not depend on the query it came from. It
+// keeps at most max patterns, dropping the least recently used, since patterns
+// read from a column may each be different.
+type patternCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // of *patternEntry, most recently used first
+	m     map[string]*list.Element
+}
+
+type patternEntry struct {
+	key string
+	re  *regexp.Regexp
+}
+
+var patterns = newPatternCache(256)
+
+func newPatternCache(max int) *patternCache {
+	return &patternCache{max: max, order: list.New(), m: make(map[string]*list.Element)}
+}
+
+// compile returns the compiled expr, cached under key.
+func (c *patternCache) compile(key, expr string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.m[key]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*patternEntry).re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %w", key, err)
+	}
+	c.m[key] = c.order.PushFront(&patternEntry{key: key, re: re})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.m, oldest.Value.(*patternEntry).key)
+	}
+	return re, nil
+}
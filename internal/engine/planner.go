@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/kevin-cantwell/csql/internal/ast"
@@ -17,14 +18,28 @@ const (
 	AccessAttached                    // ATTACH original SQLite file directly
 )
 
+func (a BatchAccess) String() string {
+	switch a {
+	case AccessFullScan:
+		return "full_scan"
+	case AccessIndexed:
+		return "indexed"
+	case AccessAttached:
+		return "attached"
+	}
+	return fmt.Sprintf("BatchAccess(%d)", int(a))
+}
+
 // BatchTablePlan describes how a single batch source should be loaded.
 type BatchTablePlan struct {
-	Access    BatchAccess
-	Schema    string // SQL schema prefix ("static", "_src_<name>", or "" for indexed)
-	SQLTable  string // actual table name in the schema
-	JoinCol   string // batch table column (for AccessIndexed)
-	StreamCol string // streaming record column (for AccessIndexed)
-	AttachPath string // file path (for AccessAttached)
+	Access     BatchAccess
+	Schema     string                 // SQL schema prefix ("static", "_src_<name>", or "" for indexed)
+	SQLTable   string                 // actual table name in the schema
+	JoinCols   []string               // batch table key columns (for AccessIndexed)
+	StreamCols []string               // streaming record key columns, parallel to JoinCols (for AccessIndexed)
+	Filters    map[string]interface{} // batch column → literal it must equal (for AccessIndexed)
+	Residual   []ast.Expression       // other ON conjuncts, left to SQLite (for AccessIndexed)
+	AttachPath string                 // file path (for AccessAttached)
 }
 
 // AnalyzeBatchAccess walks the AST and classifies each batch source's access pattern.
@@ -32,25 +47,6 @@ type BatchTablePlan struct {
 func AnalyzeBatchAccess(stmt *ast.SelectStatement, sources map[string]source.Source) map[string]*BatchTablePlan {
 	plan := make(map[string]*BatchTablePlan)
 
-	// Build alias → source name mapping from the query
-	aliasToSource := make(map[string]string) // alias (or name) → source name
-	if stmt.From != nil {
-		name := stmt.From.Table.Name
-		alias := stmt.From.Table.Alias
-		if alias == "" {
-			alias = name
-		}
-		aliasToSource[alias] = name
-	}
-	for _, j := range stmt.Joins {
-		name := j.Table.Name
-		alias := j.Table.Alias
-		if alias == "" {
-			alias = name
-		}
-		aliasToSource[alias] = name
-	}
-
 	// Identify which sources are streaming vs batch
 	streamingNames := make(map[string]bool)
 	batchNames := make(map[string]bool)
@@ -62,12 +58,6 @@ func AnalyzeBatchAccess(stmt *ast.SelectStatement, sources map[string]source.Sou
 		}
 	}
 
-	// Check if source is a SQLite source with ATTACH support
-	type attachable interface {
-		DBPath() string
-		TableName() string
-	}
-
 	// For each batch source, determine access pattern
 	for name := range batchNames {
 		src := sources[name]
@@ -85,7 +75,7 @@ func AnalyzeBatchAccess(stmt *ast.SelectStatement, sources map[string]source.Sou
 		}
 
 		// Check if the batch source is only used in a JOIN with a simple equi-condition
-		if joinPlan := findEquiJoin(stmt, name, aliasToSource, streamingNames); joinPlan != nil {
+		if joinPlan := findEquiJoin(stmt, name, streamingNames); joinPlan != nil {
 			plan[name] = joinPlan
 			continue
 		}
@@ -101,197 +91,331 @@ func AnalyzeBatchAccess(stmt *ast.SelectStatement, sources map[string]source.Sou
 	return plan
 }
 
-// findEquiJoin checks if the given batch source is only referenced in a JOIN with a
-// single equi-condition (col = col) against a streaming or non-batch source.
-// Returns a BatchTablePlan with AccessIndexed if found, nil otherwise.
-func findEquiJoin(stmt *ast.SelectStatement, batchName string, aliasToSource map[string]string, streamingNames map[string]bool) *BatchTablePlan {
-	// If the batch table is in the FROM clause, it's the primary scan target → full scan
-	if stmt.From != nil && aliasToSource[stmt.From.Table.Name] == batchName {
-		return nil
-	}
-	if stmt.From != nil && stmt.From.Table.Alias != "" && aliasToSource[stmt.From.Table.Alias] == batchName {
-		return nil
-	}
+// tableUse is a single reference to a table in a FROM or JOIN clause, together with
+// the SELECT whose clause holds it.
+type tableUse struct {
+	sel  *ast.SelectStatement
+	ref  *ast.TableRef
+	join *ast.JoinClause // nil when the table is in FROM
+}
+
+// collectTableUses returns every table reference in sel, including those inside
+// common table expressions, derived tables and expression subqueries. References
+// to CTE names in scope are not table uses and are skipped.
+func collectTableUses(sel *ast.SelectStatement) []tableUse {
+	var uses []tableUse
+	ast.Walk(tableUseVisitor{uses: &uses}, sel)
+	return uses
+}
+
+// tableUseVisitor visits the parts of sel, in which the names in ctes refer to
+// common table expressions rather than tables. They are kept in lower case,
+// since SQLite matches names without regard to case.
+type tableUseVisitor struct {
+	uses *[]tableUse
+	sel  *ast.SelectStatement
+	ctes map[string]bool
+}
 
-	// Find the JOIN clause for this batch source
-	for _, j := range stmt.Joins {
-		joinAlias := j.Table.Alias
-		if joinAlias == "" {
-			joinAlias = j.Table.Name
+func (v tableUseVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.SelectStatement:
+		v.sel = n
+		if n.With != nil {
+			scoped := make(map[string]bool, len(v.ctes)+len(n.With.CTEs))
+			for name := range v.ctes {
+				scoped[name] = true
+			}
+			for _, cte := range n.With.CTEs {
+				scoped[strings.ToLower(cte.Name)] = true
+			}
+			v.ctes = scoped
 		}
-		if aliasToSource[joinAlias] != batchName {
-			continue
+	case *ast.FromClause:
+		if !v.ctes[strings.ToLower(n.Table.QualifiedName())] {
+			*v.uses = append(*v.uses, tableUse{sel: v.sel, ref: &n.Table})
 		}
-
-		// Check if the ON condition is a simple equi-condition: colA = colB
-		batchCol, streamCol := extractEquiJoinCols(j.Condition, joinAlias, aliasToSource, streamingNames)
-		if batchCol == "" {
-			return nil
+	case *ast.JoinClause:
+		if !v.ctes[strings.ToLower(n.Table.QualifiedName())] {
+			*v.uses = append(*v.uses, tableUse{sel: v.sel, ref: &n.Table, join: n})
 		}
+	}
+	return v
+}
 
-		return &BatchTablePlan{
-			Access:    AccessIndexed,
-			Schema:    "", // lives in window DB directly
-			SQLTable:  batchName,
-			JoinCol:   batchCol,
-			StreamCol: streamCol,
+// usedSources returns the names, in lower case, of the sources stmt reads: the
+// tables it names outside of CTEs, and the schemas of its schema-qualified
+// tables.
+func usedSources(stmt *ast.SelectStatement) map[string]bool {
+	used := make(map[string]bool)
+	for _, u := range collectTableUses(stmt) {
+		switch {
+		case u.ref.Subquery != nil:
+		case u.ref.Schema != "":
+			used[strings.ToLower(u.ref.Schema)] = true
+		default:
+			used[strings.ToLower(u.ref.Name)] = true
 		}
 	}
+	return used
+}
 
-	return nil
+// qualifiedTables returns the schema-qualified table references in stmt, each
+// distinct table once, in the order they appear.
+func qualifiedTables(stmt *ast.SelectStatement) []ast.TableRef {
+	var refs []ast.TableRef
+	seen := make(map[string]bool)
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if ref, ok := n.(*ast.TableRef); ok && ref.Schema != "" && !seen[ref.QualifiedName()] {
+			seen[ref.QualifiedName()] = true
+			refs = append(refs, *ref)
+		}
+		return true
+	})
+	return refs
 }
 
-// extractEquiJoinCols extracts columns from a simple equi-condition (col = col).
-// Returns (batchCol, streamCol) if found, or ("", "") otherwise.
-// batchAlias is the alias (or name) used in the query for the batch table.
-func extractEquiJoinCols(cond ast.Expression, batchAlias string, aliasToSource map[string]string, streamingNames map[string]bool) (string, string) {
-	bin, ok := cond.(*ast.BinaryExpr)
-	if !ok || bin.Op != ast.EQ {
-		return "", ""
+// selectAliases maps each alias (or bare name) in a SELECT's FROM and JOIN clauses
+// to its source name. Derived tables map to "" since they are not sources.
+func selectAliases(sel *ast.SelectStatement) map[string]string {
+	aliasToSource := make(map[string]string)
+	add := func(t ast.TableRef) {
+		alias := t.Alias
+		if alias == "" {
+			alias = t.Name
+		}
+		aliasToSource[alias] = t.QualifiedName()
 	}
-
-	leftCol, ok := bin.Left.(*ast.ColumnRef)
-	if !ok {
-		return "", ""
+	if sel.From != nil {
+		add(sel.From.Table)
 	}
-	rightCol, ok := bin.Right.(*ast.ColumnRef)
-	if !ok {
-		return "", ""
+	for _, j := range sel.Joins {
+		add(j.Table)
 	}
+	return aliasToSource
+}
 
-	// Determine which side is the batch table and which is non-batch
-	leftIsBatch := leftCol.Table == batchAlias
-	rightIsBatch := rightCol.Table == batchAlias
+// findEquiJoin checks if the given batch source is referenced exactly once, in a JOIN
+// with a single equi-condition (col = col) against a streaming source. The reference
+// may be in any nested SELECT.
+// Returns a BatchTablePlan with AccessIndexed if found, nil otherwise.
+func findEquiJoin(stmt *ast.SelectStatement, batchName string, streamingNames map[string]bool) *BatchTablePlan {
+	var uses []tableUse
+	for _, u := range collectTableUses(stmt) {
+		if u.ref.Subquery == nil && u.ref.QualifiedName() == batchName {
+			uses = append(uses, u)
+		}
+	}
+	if len(uses) != 1 {
+		return nil
+	}
 
-	if leftIsBatch && !rightIsBatch {
-		return leftCol.Column, rightCol.Column
+	// If the batch table is in a FROM clause, it's the primary scan target → full scan
+	u := uses[0]
+	if u.join == nil {
+		return nil
 	}
-	if rightIsBatch && !leftIsBatch {
-		return rightCol.Column, leftCol.Column
+
+	// Only rows matching a streaming record are loaded, so the join must not
+	// need unmatched batch rows.
+	if u.join.Type != ast.InnerJoin && u.join.Type != ast.LeftJoin {
+		return nil
 	}
 
-	return "", ""
-}
+	joinAlias := u.ref.Alias
+	if joinAlias == "" {
+		joinAlias = u.ref.Name
+	}
 
-// BuildTableSchemas builds a tableSchemas map from a batch table plan.
-func BuildTableSchemas(plan map[string]*BatchTablePlan) map[string]string {
-	schemas := make(map[string]string)
-	for name, p := range plan {
-		schemas[name] = p.Schema
+	plan := &BatchTablePlan{
+		Access:   AccessIndexed,
+		Schema:   "", // lives in window DB directly
+		SQLTable: batchName,
 	}
-	return schemas
+	if len(u.join.Using) > 0 {
+		plan.JoinCols, plan.StreamCols = extractUsingCols(u.sel, u.join, streamingNames)
+	} else {
+		// Split the ON condition into key columns (colA = colB), literal filters and residuals
+		extractEquiJoinCols(u.join.Condition, joinAlias, selectAliases(u.sel), streamingNames, plan)
+	}
+	if len(plan.JoinCols) == 0 {
+		return nil
+	}
+	return plan
 }
 
-// ToSQL converts an AST SelectStatement into a SQLite SQL string.
-// tableSchemas maps source name → schema prefix (e.g., "static", "_src_users", or "" for window-local).
-// If tableSchemas is nil, no schema prefixing is applied (batch mode).
-func ToSQL(sel *ast.SelectStatement, tableSchemas map[string]string) string {
-	var b strings.Builder
+// extractEquiJoinCols splits an ON condition into its AND-ed conjuncts and sorts
+// them into plan. Each batch.col = stream.col conjunct adds a key column, each
+// batch.col = literal conjunct adds a filter, and anything else is residual.
+// The whole condition still appears in the generated SQL, so filters only narrow
+// which rows get indexed, and residuals are evaluated by SQLite as usual.
+// batchAlias is the alias (or name) used in the query for the batch table.
+func extractEquiJoinCols(cond ast.Expression, batchAlias string, aliasToSource map[string]string, streamingNames map[string]bool, plan *BatchTablePlan) {
+	for _, conj := range conjuncts(cond) {
+		bin, ok := conj.(*ast.BinaryExpr)
+		if !ok || bin.Op != ast.EQ {
+			plan.Residual = append(plan.Residual, conj)
+			continue
+		}
 
-	b.WriteString("SELECT ")
-	if sel.Distinct {
-		b.WriteString("DISTINCT ")
-	}
+		leftCol, leftIsCol := bin.Left.(*ast.ColumnRef)
+		rightCol, rightIsCol := bin.Right.(*ast.ColumnRef)
 
-	// Columns
-	for i, col := range sel.Columns {
-		if i > 0 {
-			b.WriteString(", ")
+		// Determine which side is the batch table and which is non-batch
+		leftIsBatch := leftIsCol && leftCol.Table == batchAlias
+		rightIsBatch := rightIsCol && rightCol.Table == batchAlias
+
+		if leftIsBatch && rightIsCol && !rightIsBatch && isStreamColumn(rightCol, aliasToSource, streamingNames) {
+			plan.JoinCols = append(plan.JoinCols, leftCol.Column)
+			plan.StreamCols = append(plan.StreamCols, rightCol.Column)
+			continue
 		}
-		if col.Star {
-			if col.TableRef != "" {
-				b.WriteString(col.TableRef)
-				b.WriteString(".*")
-			} else {
-				b.WriteString("*")
-			}
-		} else {
-			b.WriteString(exprToSQL(col.Expr, tableSchemas))
-			if col.Alias != "" {
-				b.WriteString(" AS ")
-				b.WriteString(quoteIdent(col.Alias))
-			}
+		if rightIsBatch && leftIsCol && !leftIsBatch && isStreamColumn(leftCol, aliasToSource, streamingNames) {
+			plan.JoinCols = append(plan.JoinCols, rightCol.Column)
+			plan.StreamCols = append(plan.StreamCols, leftCol.Column)
+			continue
+		}
+		if v, ok := literalValue(bin.Right); ok && leftIsBatch {
+			addFilter(plan, leftCol.Column, v)
+			continue
 		}
+		if v, ok := literalValue(bin.Left); ok && rightIsBatch {
+			addFilter(plan, rightCol.Column, v)
+			continue
+		}
+		plan.Residual = append(plan.Residual, conj)
 	}
+}
 
-	// FROM
-	if sel.From != nil {
-		b.WriteString(" FROM ")
-		b.WriteString(tableRefToSQL(sel.From.Table, tableSchemas))
+func addFilter(plan *BatchTablePlan, col string, v interface{}) {
+	if plan.Filters == nil {
+		plan.Filters = make(map[string]interface{})
 	}
+	plan.Filters[col] = v
+}
 
-	// JOINs
-	for _, j := range sel.Joins {
-		switch j.Type {
-		case ast.LeftJoin:
-			b.WriteString(" LEFT JOIN ")
-		case ast.RightJoin:
-			b.WriteString(" RIGHT JOIN ")
-		default:
-			b.WriteString(" JOIN ")
+// literalValue returns the Go value of a number or string literal.
+func literalValue(expr ast.Expression) (interface{}, bool) {
+	lit, ok := expr.(*ast.LiteralExpr)
+	if !ok {
+		return nil, false
+	}
+	switch lit.Type {
+	case ast.NUMERIC:
+		f, err := strconv.ParseFloat(lit.Value, 64)
+		if err != nil {
+			return nil, false
 		}
-		b.WriteString(tableRefToSQL(j.Table, tableSchemas))
-		b.WriteString(" ON ")
-		b.WriteString(exprToSQL(j.Condition, tableSchemas))
+		return f, true
+	case ast.STRING:
+		return lit.Unquoted(), true
 	}
+	return nil, false
+}
 
-	// WHERE
-	if sel.Where != nil {
-		b.WriteString(" WHERE ")
-		b.WriteString(exprToSQL(sel.Where, tableSchemas))
+// conjuncts flattens a tree of ANDs into its operands.
+func conjuncts(expr ast.Expression) []ast.Expression {
+	if bin, ok := expr.(*ast.BinaryExpr); ok && bin.Op == ast.AND {
+		return append(conjuncts(bin.Left), conjuncts(bin.Right)...)
 	}
+	if expr == nil {
+		return nil
+	}
+	return []ast.Expression{expr}
+}
 
-	// GROUP BY
-	if len(sel.GroupBy) > 0 {
-		b.WriteString(" GROUP BY ")
-		for i, expr := range sel.GroupBy {
-			if i > 0 {
-				b.WriteString(", ")
-			}
-			b.WriteString(exprToSQL(expr, tableSchemas))
+// extractUsingCols returns the columns of a USING join, which are the key columns
+// on both the batch and the streaming side. They are read from the streaming
+// records, so every table joined before this one must be a streaming source.
+func extractUsingCols(sel *ast.SelectStatement, join *ast.JoinClause, streamingNames map[string]bool) ([]string, []string) {
+	if sel.From == nil || !streamingNames[sel.From.Table.QualifiedName()] {
+		return nil, nil
+	}
+	for i := range sel.Joins {
+		if &sel.Joins[i] == join {
+			break
+		}
+		if !streamingNames[sel.Joins[i].Table.QualifiedName()] {
+			return nil, nil
 		}
 	}
+	return join.Using, join.Using
+}
 
-	// ORDER BY
-	if len(sel.OrderBy) > 0 {
-		b.WriteString(" ORDER BY ")
-		for i, ob := range sel.OrderBy {
-			if i > 0 {
-				b.WriteString(", ")
-			}
-			b.WriteString(exprToSQL(ob.Expr, tableSchemas))
-			if ob.Desc {
-				b.WriteString(" DESC")
-			}
-		}
+// isStreamColumn reports whether ref can be read straight from a streaming record.
+// Columns of derived tables or other batch tables cannot, since their names need
+// not match any field of the incoming records. Unqualified columns are assumed to
+// belong to the stream.
+func isStreamColumn(ref *ast.ColumnRef, aliasToSource map[string]string, streamingNames map[string]bool) bool {
+	if ref.Table == "" {
+		return true
 	}
+	return streamingNames[aliasToSource[ref.Table]]
+}
 
-	// LIMIT
-	if sel.Limit != nil {
-		b.WriteString(fmt.Sprintf(" LIMIT %d", *sel.Limit))
+// BuildTableSchemas builds a tableSchemas map from a batch table plan.
+func BuildTableSchemas(plan map[string]*BatchTablePlan) map[string]string {
+	schemas := make(map[string]string)
+	for name, p := range plan {
+		schemas[name] = p.Schema
 	}
+	return schemas
+}
 
-	return b.String()
+// ToSQL converts an AST SelectStatement into a SQLite SQL string.
+// tableSchemas maps source name → schema prefix (e.g., "static", "_src_users", or "" for window-local).
+// If tableSchemas is nil, no schema prefixing is applied (batch mode).
+func ToSQL(sel *ast.SelectStatement, tableSchemas map[string]string) string {
+	return ToSQLWithPlans(sel, tableSchemas, nil)
 }
 
-func tableRefToSQL(t ast.TableRef, tableSchemas map[string]string) string {
-	name := t.Name
-	if schema, ok := tableSchemas[name]; ok && schema != "" {
-		name = quoteIdent(schema) + "." + quoteIdent(name)
-	} else {
-		name = quoteIdent(name)
+// columnAlias returns the output name for a SELECT list column. A cast of a bare
+// column keeps the column's name (as in Postgres) instead of SQLite's expression text.
+// A time expression that is not a cast is named after its csql text, since the SQL
+// SQLite would name it after is epoch arithmetic. A JSON path is named after its
+// last key; for any other column "" is returned, leaving SQLite to name it.
+func columnAlias(col ast.Column) string {
+	if col.Alias != "" {
+		return col.Alias
+	}
+	expr := col.Expr
+	if _, ok := expr.(*ast.CastExpr); !ok && isTimeExpr(expr) {
+		return ast.FormatExpr(expr)
+	}
+	if cast, ok := expr.(*ast.CastExpr); ok {
+		expr = cast.Expr
+		if ref, ok := expr.(*ast.ColumnRef); ok {
+			return ref.Column
+		}
 	}
-	if t.Alias != "" {
-		return name + " " + quoteIdent(t.Alias)
+	// A JSON path is named after its last key, as payload.user.id is "id"
+	if path, ok := expr.(*ast.PathExpr); ok {
+		for i := len(path.Path) - 1; i >= 0; i-- {
+			if !path.Path[i].IsIndex {
+				return path.Path[i].Key
+			}
+		}
+		return path.Column.Column
 	}
-	return name
+	return ""
 }
 
 // tableRefToSQLWithPlan is used when we need to substitute the actual SQL table name
 // for attached sources (where DB table name may differ from source name).
+// A schema-qualified name refers to a table of an attached source's database.
 func tableRefToSQLWithPlan(t ast.TableRef, tableSchemas map[string]string, plans map[string]*BatchTablePlan) string {
+	if t.Subquery != nil {
+		return "(" + ToSQLWithPlans(t.Subquery, tableSchemas, plans) + ") " + quoteIdent(t.Alias)
+	}
+
 	name := t.Name
-	if schema, ok := tableSchemas[name]; ok && schema != "" {
+	if t.Schema != "" {
+		schema := t.Schema
+		if p, ok := plans[schema]; ok && p.Access == AccessAttached {
+			schema = p.Schema
+		}
+		name = quoteIdent(schema) + "." + quoteIdent(name)
+	} else if schema, ok := tableSchemas[name]; ok && schema != "" {
 		sqlTable := name
 		if p, ok := plans[name]; ok && p.SQLTable != "" {
 			sqlTable = p.SQLTable
@@ -311,6 +435,31 @@ func tableRefToSQLWithPlan(t ast.TableRef, tableSchemas map[string]string, plans
 func ToSQLWithPlans(sel *ast.SelectStatement, tableSchemas map[string]string, plans map[string]*BatchTablePlan) string {
 	var b strings.Builder
 
+	// WITH
+	if sel.With != nil {
+		b.WriteString("WITH ")
+		if sel.With.Recursive {
+			b.WriteString("RECURSIVE ")
+		}
+		for i, cte := range sel.With.CTEs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(quoteIdent(cte.Name))
+			if len(cte.Columns) > 0 {
+				cols := make([]string, len(cte.Columns))
+				for j, col := range cte.Columns {
+					cols[j] = quoteIdent(col)
+				}
+				b.WriteString("(" + strings.Join(cols, ", ") + ")")
+			}
+			b.WriteString(" AS (")
+			b.WriteString(ToSQLWithPlans(cte.Select, tableSchemas, plans))
+			b.WriteString(")")
+		}
+		b.WriteString(" ")
+	}
+
 	b.WriteString("SELECT ")
 	if sel.Distinct {
 		b.WriteString("DISTINCT ")
@@ -322,16 +471,16 @@ func ToSQLWithPlans(sel *ast.SelectStatement, tableSchemas map[string]string, pl
 		}
 		if col.Star {
 			if col.TableRef != "" {
-				b.WriteString(col.TableRef)
+				b.WriteString(quoteIdent(col.TableRef))
 				b.WriteString(".*")
 			} else {
 				b.WriteString("*")
 			}
 		} else {
-			b.WriteString(exprToSQL(col.Expr, tableSchemas))
-			if col.Alias != "" {
+			b.WriteString(exprToSQL(col.Expr, tableSchemas, plans))
+			if alias := columnAlias(col); alias != "" {
 				b.WriteString(" AS ")
-				b.WriteString(quoteIdent(col.Alias))
+				b.WriteString(quoteIdent(alias))
 			}
 		}
 	}
@@ -347,17 +496,32 @@ func ToSQLWithPlans(sel *ast.SelectStatement, tableSchemas map[string]string, pl
 			b.WriteString(" LEFT JOIN ")
 		case ast.RightJoin:
 			b.WriteString(" RIGHT JOIN ")
+		case ast.FullJoin:
+			b.WriteString(" FULL JOIN ")
+		case ast.CrossJoin:
+			b.WriteString(" CROSS JOIN ")
+		case ast.CommaJoin:
+			b.WriteString(", ")
 		default:
 			b.WriteString(" JOIN ")
 		}
 		b.WriteString(tableRefToSQLWithPlan(j.Table, tableSchemas, plans))
-		b.WriteString(" ON ")
-		b.WriteString(exprToSQL(j.Condition, tableSchemas))
+		if j.Condition != nil {
+			b.WriteString(" ON ")
+			b.WriteString(exprToSQL(j.Condition, tableSchemas, plans))
+		}
+		if len(j.Using) > 0 {
+			cols := make([]string, len(j.Using))
+			for i, col := range j.Using {
+				cols[i] = quoteIdent(col)
+			}
+			b.WriteString(" USING (" + strings.Join(cols, ", ") + ")")
+		}
 	}
 
 	if sel.Where != nil {
 		b.WriteString(" WHERE ")
-		b.WriteString(exprToSQL(sel.Where, tableSchemas))
+		b.WriteString(exprToSQL(sel.Where, tableSchemas, plans))
 	}
 
 	if len(sel.GroupBy) > 0 {
@@ -366,17 +530,29 @@ func ToSQLWithPlans(sel *ast.SelectStatement, tableSchemas map[string]string, pl
 			if i > 0 {
 				b.WriteString(", ")
 			}
-			b.WriteString(exprToSQL(expr, tableSchemas))
+			b.WriteString(exprToSQL(expr, tableSchemas, plans))
 		}
 	}
 
+	if sel.Having != nil {
+		b.WriteString(" HAVING ")
+		b.WriteString(exprToSQL(sel.Having, tableSchemas, plans))
+	}
+
+	for _, c := range sel.Compound {
+		b.WriteString(" ")
+		b.WriteString(setOpToSQL(c.Op))
+		b.WriteString(" ")
+		b.WriteString(ToSQLWithPlans(c.Select, tableSchemas, plans))
+	}
+
 	if len(sel.OrderBy) > 0 {
 		b.WriteString(" ORDER BY ")
 		for i, ob := range sel.OrderBy {
 			if i > 0 {
 				b.WriteString(", ")
 			}
-			b.WriteString(exprToSQL(ob.Expr, tableSchemas))
+			b.WriteString(exprToSQL(ob.Expr, tableSchemas, plans))
 			if ob.Desc {
 				b.WriteString(" DESC")
 			}
@@ -385,25 +561,41 @@ func ToSQLWithPlans(sel *ast.SelectStatement, tableSchemas map[string]string, pl
 
 	if sel.Limit != nil {
 		b.WriteString(fmt.Sprintf(" LIMIT %d", *sel.Limit))
+		if sel.Offset != nil {
+			b.WriteString(fmt.Sprintf(" OFFSET %d", *sel.Offset))
+		}
 	}
 
 	return b.String()
 }
 
-func exprToSQL(expr ast.Expression, st map[string]string) string {
+func exprToSQL(expr ast.Expression, st map[string]string, plans map[string]*BatchTablePlan) string {
 	switch e := expr.(type) {
 	case *ast.BinaryExpr:
-		left := exprToSQL(e.Left, st)
-		right := exprToSQL(e.Right, st)
+		left := exprToSQL(e.Left, st, plans)
+		right := exprToSQL(e.Right, st, plans)
+		switch e.Op {
+		case ast.ILIKE:
+			return fmt.Sprintf("%s(%s, %s)", ilikeFunc, right, left)
+		case ast.TILDE:
+			return fmt.Sprintf("(%s REGEXP %s)", left, right)
+		case ast.CONCAT:
+			return fmt.Sprintf("(%s || %s)", concatOperand(e.Left, left), concatOperand(e.Right, right))
+		}
+		if toTimeLeft, toTimeRight := timeOperands(e); toTimeLeft {
+			left = timeFunc + "(" + left + ")"
+		} else if toTimeRight {
+			right = timeFunc + "(" + right + ")"
+		}
 		op := tokenToSQLOp(e.Op)
 		return fmt.Sprintf("(%s %s %s)", left, op, right)
 
 	case *ast.UnaryExpr:
-		operand := exprToSQL(e.Operand, st)
+		operand := exprToSQL(e.Operand, st, plans)
 		if e.Op == ast.NOT {
 			return fmt.Sprintf("(NOT %s)", operand)
 		}
-		return fmt.Sprintf("(-%s)", operand)
+		return fmt.Sprintf("(%s%s)", tokenToSQLOp(e.Op), operand)
 
 	case *ast.ColumnRef:
 		if e.Table != "" {
@@ -411,12 +603,17 @@ func exprToSQL(expr ast.Expression, st map[string]string) string {
 		}
 		return quoteIdent(e.Column)
 
+	case *ast.PathExpr:
+		return fmt.Sprintf("json_extract(%s, %s)", exprToSQL(e.Column, st, plans), quoteLiteral(jsonPath(e.Path)))
+
 	case *ast.LiteralExpr:
 		switch e.Type {
 		case ast.STRING:
 			return e.Value // already quoted with single quotes
 		case ast.NUMERIC:
 			return e.Value
+		case ast.TIMESTAMP, ast.DATE, ast.DURATION, ast.INTERVAL:
+			return timeLiteralSQL(e)
 		case ast.TRUE:
 			return "1"
 		case ast.FALSE:
@@ -425,28 +622,48 @@ func exprToSQL(expr ast.Expression, st map[string]string) string {
 			return "NULL"
 		}
 
+	case *ast.ParamExpr:
+		return "?" + strconv.Itoa(e.Index)
+
 	case *ast.StarExpr:
 		return "*"
 
 	case *ast.FunctionExpr:
+		if isTimeExpr(e) {
+			return "unixepoch('now', 'subsec')"
+		}
 		var args []string
 		for _, arg := range e.Args {
-			args = append(args, exprToSQL(arg, st))
+			args = append(args, exprToSQL(arg, st, plans))
+		}
+		distinct := ""
+		if e.Distinct {
+			distinct = "DISTINCT "
+		}
+		call := fmt.Sprintf("%s(%s%s)", e.Name, distinct, strings.Join(args, ", "))
+		if e.Filter != nil {
+			call += " FILTER (WHERE " + exprToSQL(e.Filter, st, plans) + ")"
 		}
-		return fmt.Sprintf("%s(%s)", e.Name, strings.Join(args, ", "))
+		if e.Over != nil {
+			call += " OVER (" + windowSpecToSQL(e.Over, st, plans) + ")"
+		}
+		return call
 
 	case *ast.IsNullExpr:
-		inner := exprToSQL(e.Expr, st)
+		inner := exprToSQL(e.Expr, st, plans)
 		if e.Not {
 			return fmt.Sprintf("(%s IS NOT NULL)", inner)
 		}
 		return fmt.Sprintf("(%s IS NULL)", inner)
 
 	case *ast.InExpr:
-		inner := exprToSQL(e.Expr, st)
+		inner := exprToSQL(e.Expr, st, plans)
 		var vals []string
+		if e.Subquery != nil {
+			vals = append(vals, ToSQLWithPlans(e.Subquery, st, plans))
+		}
 		for _, v := range e.Values {
-			vals = append(vals, exprToSQL(v, st))
+			vals = append(vals, exprToSQL(v, st, plans))
 		}
 		not := ""
 		if e.Not {
@@ -454,10 +671,25 @@ func exprToSQL(expr ast.Expression, st map[string]string) string {
 		}
 		return fmt.Sprintf("(%s %sIN (%s))", inner, not, strings.Join(vals, ", "))
 
+	case *ast.SubqueryExpr:
+		return "(" + ToSQLWithPlans(e.Select, st, plans) + ")"
+
+	case *ast.ExistsExpr:
+		return "(EXISTS (" + ToSQLWithPlans(e.Subquery, st, plans) + "))"
+
 	case *ast.BetweenExpr:
-		inner := exprToSQL(e.Expr, st)
-		low := exprToSQL(e.Low, st)
-		high := exprToSQL(e.High, st)
+		inner := exprToSQL(e.Expr, st, plans)
+		low := exprToSQL(e.Low, st, plans)
+		high := exprToSQL(e.High, st, plans)
+		if isTimeExpr(e.Expr) || isTimeExpr(e.Low) || isTimeExpr(e.High) {
+			toTime := func(expr ast.Expression, sql string) string {
+				if isTimeExpr(expr) {
+					return sql
+				}
+				return timeFunc + "(" + sql + ")"
+			}
+			inner, low, high = toTime(e.Expr, inner), toTime(e.Low, low), toTime(e.High, high)
+		}
 		not := ""
 		if e.Not {
 			not = "NOT "
@@ -465,16 +697,87 @@ func exprToSQL(expr ast.Expression, st map[string]string) string {
 		return fmt.Sprintf("(%s %sBETWEEN %s AND %s)", inner, not, low, high)
 
 	case *ast.LikeExpr:
-		inner := exprToSQL(e.Expr, st)
-		pattern := exprToSQL(e.Pattern, st)
+		inner := exprToSQL(e.Expr, st, plans)
+		pattern := exprToSQL(e.Pattern, st, plans)
 		not := ""
 		if e.Not {
 			not = "NOT "
 		}
-		return fmt.Sprintf("(%s %sLIKE %s)", inner, not, pattern)
+		if e.Op == ast.ILIKE {
+			return fmt.Sprintf("(%s%s(%s, %s))", not, ilikeFunc, pattern, inner)
+		}
+		return fmt.Sprintf("(%s %s%s %s)", inner, not, tokenToSQLOp(e.Op), pattern)
+
+	case *ast.CastExpr:
+		inner := exprToSQL(e.Expr, st, plans)
+		switch e.Type {
+		case "BOOLEAN":
+			return boolFunc + "(" + inner + ")"
+		case "JSON":
+			return fmt.Sprintf("json(%s)", inner)
+		case "TIMESTAMP":
+			if isTimeExpr(e.Expr) {
+				return inner
+			}
+			return timeFunc + "(" + inner + ")"
+		default:
+			return fmt.Sprintf("CAST(%s AS %s)", inner, e.Type)
+		}
+
+	case *ast.CaseExpr:
+		var b strings.Builder
+		b.WriteString("(CASE")
+		if e.Operand != nil {
+			b.WriteString(" ")
+			b.WriteString(exprToSQL(e.Operand, st, plans))
+		}
+		for _, w := range e.Whens {
+			b.WriteString(" WHEN ")
+			b.WriteString(exprToSQL(w.Cond, st, plans))
+			b.WriteString(" THEN ")
+			b.WriteString(exprToSQL(w.Result, st, plans))
+		}
+		if e.Else != nil {
+			b.WriteString(" ELSE ")
+			b.WriteString(exprToSQL(e.Else, st, plans))
+		}
+		b.WriteString(" END)")
+		return b.String()
 	}
 
-	return "?"
+	// The parser only produces the expressions above; TestToSQLCoversParser
+	// checks that each of them, and each operator, has SQL.
+	panic(fmt.Sprintf("unsupported expression %T", expr))
+}
+
+// concatOperand returns the SQL for an operand of ||, which writes whole
+// numbers without a fractional part. String literals and nested || need no
+// conversion.
+func concatOperand(expr ast.Expression, sql string) string {
+	switch e := expr.(type) {
+	case *ast.LiteralExpr:
+		if e.Type == ast.STRING {
+			return sql
+		}
+	case *ast.BinaryExpr:
+		if e.Op == ast.CONCAT {
+			return sql
+		}
+	}
+	return textFunc + "(" + sql + ")"
+}
+
+func setOpToSQL(op ast.SetOp) string {
+	switch op {
+	case ast.UnionAll:
+		return "UNION ALL"
+	case ast.Intersect:
+		return "INTERSECT"
+	case ast.Except:
+		return "EXCEPT"
+	default:
+		return "UNION"
+	}
 }
 
 func tokenToSQLOp(t ast.TokenType) string {
@@ -507,8 +810,26 @@ func tokenToSQLOp(t ast.TokenType) string {
 		return "OR"
 	case ast.LIKE:
 		return "LIKE"
+	case ast.GLOB:
+		return "GLOB"
+	case ast.REGEXP:
+		return "REGEXP"
+	case ast.CONCAT:
+		return "||"
+	case ast.AMPERSAND:
+		return "&"
+	case ast.PIPE:
+		return "|"
+	case ast.LSHIFT:
+		return "<<"
+	case ast.RSHIFT:
+		return ">>"
+	case ast.TILDE:
+		return "~"
 	default:
-		return "?"
+		// The parser only produces the operators above, as
+		// TestToSQLCoversParser checks.
+		panic(fmt.Sprintf("unsupported operator %s", t))
 	}
 }
 
@@ -522,3 +843,85 @@ func quoteIdent(s string) string {
 func quoteLiteral(s string) string {
 	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
 }
+
+// jsonPath renders path steps in SQLite's JSON path syntax, e.g. $.user.tags[0].
+// Keys that are not plain identifiers are double-quoted, with their quotes and
+// backslashes escaped.
+func jsonPath(steps []ast.PathStep) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, step := range steps {
+		switch {
+		case step.IsIndex:
+			fmt.Fprintf(&b, "[%d]", step.Index)
+		case isPlainKey(step.Key):
+			b.WriteString("." + step.Key)
+		default:
+			b.WriteString(`."` + pathKeyEscaper.Replace(step.Key) + `"`)
+		}
+	}
+	return b.String()
+}
+
+// pathKeyEscaper escapes a quoted JSON path key. SQLite ends the key at the
+// first double quote, even after a backslash, so quotes are written as \u0022.
+var pathKeyEscaper = strings.NewReplacer(`"`, `\u0022`, `\`, `\\`)
+
+func isPlainKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, ch := range key {
+		if !(ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// windowSpecToSQL renders the body of an analytic function's OVER clause.
+func windowSpecToSQL(spec *ast.WindowSpec, st map[string]string, plans map[string]*BatchTablePlan) string {
+	var parts []string
+	if len(spec.PartitionBy) > 0 {
+		var exprs []string
+		for _, expr := range spec.PartitionBy {
+			exprs = append(exprs, exprToSQL(expr, st, plans))
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(exprs, ", "))
+	}
+	if len(spec.OrderBy) > 0 {
+		var orders []string
+		for _, ob := range spec.OrderBy {
+			order := exprToSQL(ob.Expr, st, plans)
+			if ob.Desc {
+				order += " DESC"
+			}
+			orders = append(orders, order)
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(orders, ", "))
+	}
+	if f := spec.Frame; f != nil {
+		if f.End == nil {
+			parts = append(parts, f.Unit+" "+frameBoundToSQL(f.Start, st, plans))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s BETWEEN %s AND %s", f.Unit,
+				frameBoundToSQL(f.Start, st, plans), frameBoundToSQL(*f.End, st, plans)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func frameBoundToSQL(b ast.FrameBound, st map[string]string, plans map[string]*BatchTablePlan) string {
+	switch b.Kind {
+	case ast.UnboundedPreceding:
+		return "UNBOUNDED PRECEDING"
+	case ast.UnboundedFollowing:
+		return "UNBOUNDED FOLLOWING"
+	case ast.Preceding:
+		return exprToSQL(b.Offset, st, plans) + " PRECEDING"
+	case ast.Following:
+		return exprToSQL(b.Offset, st, plans) + " FOLLOWING"
+	default:
+		return "CURRENT ROW"
+	}
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -23,6 +24,70 @@ func TestToSQL(t *testing.T) {
 		{
 			input: "SELECT s.action, u.name FROM stdin s JOIN users u ON s.uid = u.id",
 		},
+		{
+			input: "SELECT status, COUNT(*) cnt FROM stdin GROUP BY status HAVING COUNT(*) > 100",
+			want:  `SELECT "status", COUNT(*) AS "cnt" FROM "stdin" GROUP BY "status" HAVING (COUNT(*) > 100)`,
+		},
+		{
+			input: "SELECT CASE WHEN latency > 500 THEN 'slow' ELSE 'ok' END speed FROM stdin",
+			want:  `SELECT (CASE WHEN ("latency" > 500) THEN 'slow' ELSE 'ok' END) AS "speed" FROM "stdin"`,
+		},
+		{
+			input: "SELECT CASE status WHEN 200 THEN 'ok' END FROM stdin",
+			want:  `SELECT (CASE "status" WHEN 200 THEN 'ok' END) FROM "stdin"`,
+		},
+		{
+			input: "SELECT t.status FROM (SELECT status, COUNT(*) cnt FROM stdin GROUP BY status) t WHERE t.cnt > 1",
+			want:  `SELECT "t"."status" FROM (SELECT "status", COUNT(*) AS "cnt" FROM "stdin" GROUP BY "status") "t" WHERE ("t"."cnt" > 1)`,
+		},
+		{
+			input: "SELECT id, (SELECT MAX(age) FROM users) m FROM stdin WHERE uid NOT IN (SELECT id FROM blocked) AND EXISTS (SELECT 1 FROM users u WHERE u.id = stdin.uid)",
+			want:  `SELECT "id", (SELECT MAX("age") FROM "users") AS "m" FROM "stdin" WHERE (("uid" NOT IN (SELECT "id" FROM "blocked")) AND (EXISTS (SELECT 1 FROM "users" "u" WHERE ("u"."id" = "stdin"."uid"))))`,
+		},
+		{
+			input: "WITH big(uid) AS (SELECT user_id FROM orders WHERE qty > 2) SELECT * FROM big",
+			want:  `WITH "big"("uid") AS (SELECT "user_id" FROM "orders" WHERE ("qty" > 2)) SELECT * FROM "big"`,
+		},
+		{
+			input: "SELECT action FROM a UNION ALL SELECT action FROM b INTERSECT SELECT action FROM c ORDER BY action LIMIT 2",
+			want:  `SELECT "action" FROM "a" UNION ALL SELECT "action" FROM "b" INTERSECT SELECT "action" FROM "c" ORDER BY "action" LIMIT 2`,
+		},
+		{
+			input: "SELECT host || ':' || port AS addr FROM stdin WHERE flags & 4 <> 0 AND mask >> 2 == ~bits | 1",
+			want:  `SELECT ((csql_text("host") || ':') || csql_text("port")) AS "addr" FROM "stdin" WHERE ((("flags" & 4) != 0) AND (("mask" >> 2) = ((~"bits") | 1)))`,
+		},
+		{
+			input: "SELECT payload.user.id, payload['first name'], s.tags[0] tag FROM stdin s WHERE payload.level = 'error' GROUP BY payload.user.id",
+			want:  `SELECT json_extract("payload", '$.user.id') AS "id", json_extract("payload", '$."first name"') AS "first name", json_extract("s"."tags", '$[0]') AS "tag" FROM "stdin" "s" WHERE (json_extract("payload", '$.level') = 'error') GROUP BY json_extract("payload", '$.user.id')`,
+		},
+		{
+			input: `SELECT payload['say "hi"'], payload['C:\dir'] dir FROM stdin`,
+			want:  `SELECT json_extract("payload", '$."say \u0022hi\u0022"') AS "say ""hi""", json_extract("payload", '$."C:\\dir"') AS "dir" FROM "stdin"`,
+		},
+		{
+			input: "SELECT * FROM a LEFT OUTER JOIN b USING (id, day) FULL JOIN c ON b.x = c.x CROSS JOIN d, e INNER JOIN f ON f.y = e.y",
+			want:  `SELECT * FROM "a" LEFT JOIN "b" USING ("id", "day") FULL JOIN "c" ON ("b"."x" = "c"."x") CROSS JOIN "d", "e" JOIN "f" ON ("f"."y" = "e"."y")`,
+		},
+		{
+			input: "SELECT name FROM users ORDER BY name LIMIT 2, 10",
+			want:  `SELECT "name" FROM "users" ORDER BY "name" LIMIT 10 OFFSET 2`,
+		},
+		{
+			input: "SELECT CAST(zip AS TEXT), price::real p, payload::json FROM stdin",
+			want:  `SELECT CAST("zip" AS TEXT) AS "zip", CAST("price" AS REAL) AS "p", json("payload") AS "payload" FROM "stdin"`,
+		},
+		{
+			input: "SELECT (a + b)::boolean ok FROM stdin",
+			want:  `SELECT csql_bool(("a" + "b")) AS "ok" FROM "stdin"`,
+		},
+		{
+			input: "SELECT ROW_NUMBER() OVER (PARTITION BY user ORDER BY ts DESC) rn, latency - LAG(latency) OVER (ORDER BY ts) delta, SUM(bytes) OVER (ORDER BY ts ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) FROM stdin",
+			want:  `SELECT ROW_NUMBER() OVER (PARTITION BY "user" ORDER BY "ts" DESC) AS "rn", ("latency" - LAG("latency") OVER (ORDER BY "ts")) AS "delta", SUM("bytes") OVER (ORDER BY "ts" ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) FROM "stdin"`,
+		},
+		{
+			input: "SELECT \"a b\".x, `c d`.*, [my col] AS \"x\"\"y\" FROM app.[order items] \"a b\" JOIN `c d` USING ([user id])",
+			want:  `SELECT "a b"."x", "c d".*, "my col" AS "x""y" FROM "app"."order items" "a b" JOIN "c d" USING ("user id")`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -39,3 +104,105 @@ func TestToSQL(t *testing.T) {
 		}
 	}
 }
+
+// Formatting a query must not change what it means: both texts plan to the same SQL.
+func TestFormatRoundTrip(t *testing.T) {
+	inputs := []string{
+		"SELECT a - (b - c), (a - b) - c, a * (b + c), -(a * b), - -a, NOT (a AND b) FROM stdin",
+		"SELECT a = (b IS NULL), (a = b) IS NULL, a BETWEEN b + 1 AND (c AND d), x NOT LIKE 'a%' || y FROM stdin",
+		"SELECT a || b::text, CAST(a + b AS INTEGER), a & b | c << 2, ~a FROM stdin",
+		"SELECT u.name, payload.user.id, payload['a b'][0], tags[1].name FROM stdin s JOIN users u ON s.uid = u.id",
+		"SELECT users['id'] FROM events e JOIN users u ON e.uid = u.id",
+		"SELECT CASE WHEN a > 1 THEN 'x' WHEN a IS NOT NULL THEN 'y' ELSE 'z' END AS bucket FROM stdin",
+		"SELECT ROW_NUMBER() OVER (PARTITION BY a ORDER BY b DESC ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) FROM stdin",
+		"WITH RECURSIVE n (i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5) SELECT i FROM n",
+		"SELECT * FROM a, b LEFT JOIN c USING (id) FULL OUTER JOIN d ON c.x = d.x CROSS JOIN e, f",
+		"SELECT a FROM t WHERE a IN (SELECT b FROM u WHERE EXISTS (SELECT 1 FROM v WHERE v.b = u.b)) AND NOT EXISTS (SELECT 1 FROM w)",
+		"SELECT t.n FROM (SELECT name AS n FROM stdin -- inner\n) t",
+		"SELECT status, COUNT(*) FROM stdin GROUP BY status HAVING COUNT(*) > 1 ORDER BY 2 DESC LIMIT 5, 10 OVER 1h30m EVERY 10s",
+		"SELECT a FROM t INTERSECT SELECT a FROM u EXCEPT SELECT a FROM v ORDER BY a",
+		"SELECT \"a b\".x, [c].*, `select` FROM app.[order items] \"a b\", c WHERE \"a b\".\"it\"\"s\" = 1",
+	}
+	for _, input := range inputs {
+		stmts, err := ast.NewParser(strings.NewReader(input)).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		formatted := ast.Format(stmts)
+		again, err := ast.NewParser(strings.NewReader(formatted)).Parse()
+		if err != nil {
+			t.Fatalf("parse formatted %q: %v\n%s", input, err, formatted)
+		}
+		want, got := ToSQL(stmts[0].Select, nil), ToSQL(again[0].Select, nil)
+		if got != want {
+			t.Errorf("%s\nformatted as:\n%s\nwant: %s\ngot:  %s", input, formatted, want, got)
+		}
+		if twice := ast.Format(again); twice != formatted {
+			t.Errorf("formatting %q is not stable:\n%s\nthen:\n%s", input, formatted, twice)
+		}
+	}
+}
+
+// Every operator and kind of expression the parser produces must have SQL, as
+// exprToSQL and tokenToSQLOp panic on any other.
+func TestToSQLCoversParser(t *testing.T) {
+	inputs := []string{
+		"SELECT a OR b AND NOT c, a = b, a == b, a != b, a <> b, a < b, a <= b, a > b, a >= b FROM t",
+		"SELECT a LIKE 'x', a ILIKE 'x', a GLOB 'x', a REGEXP 'x', a ~ 'x', a NOT LIKE 'x', a NOT ILIKE 'x', a NOT GLOB 'x', a NOT REGEXP 'x' FROM t",
+		"SELECT a & b | c << 1 >> 2, a + b - c * d / e % f, a || b, -a, +a, ~a FROM t",
+		"SELECT a IS NULL, a IS NOT NULL, a BETWEEN 1 AND 2, a NOT BETWEEN 1 AND 2, a IN (1, 2), a NOT IN (SELECT b FROM u), EXISTS (SELECT 1 FROM u), (SELECT MAX(b) FROM u) FROM t",
+		"SELECT t.*, COUNT(*), COUNT(DISTINCT a) FILTER (WHERE a > 1) OVER (PARTITION BY b ORDER BY c ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) FROM t",
+		"SELECT CASE a WHEN 1 THEN 'x' ELSE 'y' END, CASE WHEN a THEN b END, CAST(a AS INTEGER), a::real, a::text, a::boolean, a::json, a::timestamp FROM t",
+		"SELECT payload.user.id, tags[0], :p, $2, ?, TRUE, FALSE, NULL, 1.5, TIMESTAMP '2024-01-01 00:00', DATE '2024-01-01', INTERVAL '5m', now() - 5m FROM t",
+	}
+	wantKinds := []string{
+		"*ast.BinaryExpr", "*ast.UnaryExpr", "*ast.FunctionExpr", "*ast.ColumnRef", "*ast.LiteralExpr",
+		"*ast.ParamExpr", "*ast.StarExpr", "*ast.IsNullExpr", "*ast.BetweenExpr", "*ast.InExpr",
+		"*ast.LikeExpr", "*ast.CaseExpr", "*ast.CastExpr", "*ast.SubqueryExpr", "*ast.ExistsExpr", "*ast.PathExpr",
+	}
+	wantOps := []ast.TokenType{
+		ast.OR, ast.AND, ast.EQ, ast.NEQ, ast.LT, ast.LTE, ast.GT, ast.GTE,
+		ast.LIKE, ast.ILIKE, ast.GLOB, ast.REGEXP, ast.TILDE,
+		ast.AMPERSAND, ast.PIPE, ast.LSHIFT, ast.RSHIFT,
+		ast.PLUS, ast.MINUS, ast.STAR, ast.SLASH, ast.PERCENT, ast.CONCAT, ast.NOT,
+	}
+
+	kinds := make(map[string]bool)
+	ops := make(map[ast.TokenType]bool)
+	for _, input := range inputs {
+		stmts, err := ast.NewParser(strings.NewReader(input)).Parse()
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		ast.Inspect(stmts[0].Select, func(n ast.Node) bool {
+			kinds[fmt.Sprintf("%T", n)] = true
+			switch e := n.(type) {
+			case *ast.BinaryExpr:
+				ops[e.Op] = true
+			case *ast.UnaryExpr:
+				ops[e.Op] = true
+			case *ast.LikeExpr:
+				ops[e.Op] = true
+			}
+			return true
+		})
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s: %v", input, r)
+				}
+			}()
+			ToSQL(stmts[0].Select, nil)
+		}()
+	}
+	for _, kind := range wantKinds {
+		if !kinds[kind] {
+			t.Errorf("no input has a %s", kind)
+		}
+	}
+	for _, op := range wantOps {
+		if !ops[op] {
+			t.Errorf("no input uses operator %s", op)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"database/sql/driver"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/kevin-cantwell/csql/internal/ast"
+	"modernc.org/sqlite"
+)
+
+// timeFunc is the SQLite function that converts a value to a time, as Unix
+// epoch seconds, for comparing and shifting times whatever form the data
+// holds them in. It returns NULL for a value that is not a time.
+const timeFunc = "csql_time"
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction(timeFunc, 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if sec, ok := epochSeconds(args[0]); ok {
+			return sec, nil
+		}
+		return nil, nil
+	})
+}
+
+// epochSeconds converts a date and time string or an epoch number to Unix
+// epoch seconds. Epoch numbers may count seconds, milliseconds, microseconds or
+// nanoseconds, told apart by size: any time since 1973 in milliseconds is
+// larger than any time before 5138 in seconds.
+func epochSeconds(v driver.Value) (float64, bool) {
+	var n float64
+	switch v := v.(type) {
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	case string:
+		return textEpochSeconds(v)
+	case []byte:
+		return textEpochSeconds(string(v))
+	default:
+		return 0, false
+	}
+	switch abs := math.Abs(n); {
+	case abs >= 1e17:
+		return n / 1e9, true
+	case abs >= 1e14:
+		return n / 1e6, true
+	case abs >= 1e11:
+		return n / 1e3, true
+	}
+	return n, true
+}
+
+func textEpochSeconds(s string) (float64, bool) {
+	if t, ok := ast.ParseTime(s); ok {
+		return unixSeconds(t), true
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return epochSeconds(n)
+	}
+	return 0, false
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// formatEpoch renders Unix epoch seconds as an RFC 3339 time in UTC. It
+// rounds to microseconds, the precision of a float64 for present-day times.
+func formatEpoch(sec float64) string {
+	return time.UnixMicro(int64(math.Round(sec * 1e6))).UTC().Format(time.RFC3339Nano)
+}
+
+// isTimeExpr reports whether expr is a time, which SQL represents as Unix
+// epoch seconds: a TIMESTAMP or DATE literal, now(), a cast to TIMESTAMP, or
+// a time shifted by an interval.
+func isTimeExpr(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.LiteralExpr:
+		return e.Type == ast.TIMESTAMP || e.Type == ast.DATE
+	case *ast.FunctionExpr:
+		return e.Name == "NOW" && len(e.Args) == 0 && e.Over == nil
+	case *ast.CastExpr:
+		return e.Type == "TIMESTAMP"
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case ast.PLUS:
+			return isIntervalExpr(e.Left) != isIntervalExpr(e.Right)
+		case ast.MINUS:
+			return isIntervalExpr(e.Right) && !isIntervalExpr(e.Left)
+		}
+	}
+	return false
+}
+
+// isIntervalExpr reports whether expr is a length of time, which SQL
+// represents as seconds: a duration or INTERVAL literal, or arithmetic on one.
+func isIntervalExpr(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.LiteralExpr:
+		return e.Type == ast.DURATION || e.Type == ast.INTERVAL
+	case *ast.UnaryExpr:
+		return (e.Op == ast.MINUS || e.Op == ast.PLUS) && isIntervalExpr(e.Operand)
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case ast.PLUS, ast.MINUS:
+			return isIntervalExpr(e.Left) && isIntervalExpr(e.Right)
+		case ast.STAR:
+			return isIntervalExpr(e.Left) != isIntervalExpr(e.Right)
+		case ast.SLASH:
+			return isIntervalExpr(e.Left) && !isIntervalExpr(e.Right)
+		}
+	}
+	return false
+}
+
+// timeOperands reports which operands of e hold times in the data, to be
+// converted with timeFunc: those compared with a time, and those shifted by an
+// interval, that are not already times or intervals.
+func timeOperands(e *ast.BinaryExpr) (left, right bool) {
+	plain := func(expr ast.Expression) bool {
+		return !isTimeExpr(expr) && !isIntervalExpr(expr)
+	}
+	switch e.Op {
+	case ast.EQ, ast.NEQ, ast.LT, ast.LTE, ast.GT, ast.GTE:
+		return isTimeExpr(e.Right) && plain(e.Left), isTimeExpr(e.Left) && plain(e.Right)
+	case ast.PLUS:
+		return isIntervalExpr(e.Right) && plain(e.Left), isIntervalExpr(e.Left) && plain(e.Right)
+	case ast.MINUS:
+		return isIntervalExpr(e.Right) && plain(e.Left), false
+	}
+	return false, false
+}
+
+// timeLiteralSQL renders a time or interval literal as seconds.
+func timeLiteralSQL(e *ast.LiteralExpr) string {
+	var sec float64
+	switch e.Type {
+	case ast.TIMESTAMP, ast.DATE:
+		t, _ := e.Time() // checked by the parser
+		sec = unixSeconds(t)
+	default:
+		d, _ := e.Duration()
+		sec = d.Seconds()
+	}
+	return strconv.FormatFloat(sec, 'f', -1, 64)
+}
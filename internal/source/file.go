@@ -44,6 +44,24 @@ func (s *FileSource) Close() error {
 	return nil
 }
 
+// Columns returns the header row of a CSV file, and nil for JSON files.
+func (s *FileSource) Columns() ([]string, error) {
+	if strings.ToLower(filepath.Ext(s.path)) != ".csv" {
+		return nil, nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := csv.NewReader(f).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return header, err
+}
+
 func (s *FileSource) read(ext string) {
 	defer close(s.ch)
 
@@ -78,7 +96,7 @@ func (s *FileSource) readCSV(r io.Reader) {
 		rec := make(Record, len(header))
 		for i, col := range header {
 			if i < len(row) {
-				rec[col] = inferType(row[i])
+				rec[col] = InferType(row[i])
 			}
 		}
 		s.ch <- rec
@@ -96,8 +114,13 @@ func (s *FileSource) readJSONLines(r io.Reader) {
 	}
 }
 
-// inferType converts a CSV string value to a typed value.
-func inferType(s string) interface{} {
+// InferType converts a CSV string value to a typed value. A number written
+// with a leading zero, such as the zip code 02134, stays a string, since it is
+// more likely a code than a quantity and converting it would lose the zero.
+func InferType(s string) interface{} {
+	if len(s) > 1 && s[0] == '0' && '0' <= s[1] && s[1] <= '9' {
+		return s
+	}
 	if f, err := strconv.ParseFloat(s, 64); err == nil {
 		if !strings.Contains(s, ".") {
 			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
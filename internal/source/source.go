@@ -29,12 +29,19 @@ type Source interface {
 	Close() error
 }
 
+// ColumnLister is implemented by sources whose column names are known before any
+// records are read. Columns returns nil when they are not, as for a file of
+// JSON lines whose records may each have different fields.
+type ColumnLister interface {
+	Columns() ([]string, error)
+}
+
 // Config describes a source from a --source flag.
 type Config struct {
 	Name   string
 	URI    string
 	Scheme string
-	Table  string // optional: source table name (for sqlite, defaults to Name)
+	Table  string // optional: source table name (for sqlite, defaults to Name; other tables are read as Name.table)
 }
 
 // ParseURI parses a source URI like "file://path.csv", "sqlite://path.db?table=t", or "stdin".
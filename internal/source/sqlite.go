@@ -9,7 +9,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// SQLiteSource reads records from a table in a SQLite database file.
+// SQLiteSource reads records from a table in a SQLite database file. Every
+// other table and view of the database can be queried through it as well, as
+// name.table.
 type SQLiteSource struct {
 	name  string
 	path  string
@@ -19,7 +21,8 @@ type SQLiteSource struct {
 }
 
 // NewSQLiteSource creates a source that reads all rows from a SQLite table.
-// The path is the database file. The table defaults to name if not specified.
+// The path is the database file. The table defaults to name if not specified,
+// and need not exist when the source is only used for its other tables.
 // The goroutine is started lazily on first call to Records().
 func NewSQLiteSource(name, path, table string) (*SQLiteSource, error) {
 	if table == "" {
@@ -53,6 +56,43 @@ func (s *SQLiteSource) Close() error {
 	return nil
 }
 
+// Columns returns the columns of the table, in table order.
+func (s *SQLiteSource) Columns() ([]string, error) {
+	return s.TableColumns(s.table)
+}
+
+// TableColumns returns the columns of any table or view in the database, in
+// table order.
+func (s *SQLiteSource) TableColumns(table string) ([]string, error) {
+	db, err := sql.Open("sqlite", s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info(%s)", quoteLiteral(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no such table: %s", table)
+	}
+	return cols, nil
+}
+
 func (s *SQLiteSource) read() {
 	defer close(s.ch)
 
@@ -91,6 +131,10 @@ func (s *SQLiteSource) read() {
 	}
 }
 
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
+
 func quoteIdent(s string) string {
 	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }